@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"time"
 
 	"go.uber.org/multierr"
 )
@@ -17,9 +18,16 @@ func check(s Schedule) error {
 		checkShiftListDupes,
 		checkShiftListDupeEmail,
 		checkShiftListSorted,
+		checkShiftListOverlap,
 		checkExtendMinDays,
 		checkExtendMaxDays,
 		checkExtendMinLessThanMax,
+		checkExtendStartAfterUsers,
+		checkRotation,
+		checkRotationGaps,
+		checkLayers,
+		checkLayerOverlap,
+		checkRoster,
 	} {
 		errs = multierr.Append(errs, check(s))
 
@@ -45,8 +53,9 @@ func checkShiftListDupes(s Schedule) error {
 
 func checkShiftListDupeEmail(s Schedule) error {
 	for i := 0; i < len(s.Shifts)-1; i += 1 {
-		if s.Shifts[i].Email == s.Shifts[i+1].Email {
-			return fmt.Errorf("%v appears for two shifts in a row.  this should instead be expressed as a single, longer shift", s.Shifts[i].Email)
+		a, b := s.Shifts[i], s.Shifts[i+1]
+		if a.Email == b.Email && a.End.Equal(b.Start) {
+			return fmt.Errorf("%v appears for two shifts in a row.  this should instead be expressed as a single, longer shift", a.Email)
 		}
 	}
 	return nil
@@ -67,6 +76,15 @@ func checkShiftListSorted(s Schedule) error {
 	return nil
 }
 
+func checkShiftListOverlap(s Schedule) error {
+	for i := 0; i < len(s.Shifts)-1; i += 1 {
+		if s.Shifts[i].End.After(s.Shifts[i+1].Start) {
+			return fmt.Errorf("shifts of %v and %v overlap from %v", s.Shifts[i].Email, s.Shifts[i+1].Email, s.Shifts[i+1].Start.Format(_timeFmt))
+		}
+	}
+	return nil
+}
+
 const (
 	_minMaxDays = 21
 	_maxMaxDays = 56
@@ -103,3 +121,91 @@ func checkExtendMinLessThanMax(s Schedule) error {
 	}
 	return fmt.Errorf("extend.minDays must be less than extend.maxDays, but %v >= %v", s.Extend.MinDays, s.Extend.MaxDays)
 }
+
+func checkExtendStartAfterUsers(s Schedule) error {
+	if s.Extend == nil {
+		return nil
+	}
+	var errs error
+	for u := range s.Extend.StartAfter {
+		if !contains(s.Extend.Users, u) {
+			errs = multierr.Append(errs, fmt.Errorf("extend.startAfter has %v, who is missing from extend.users", u))
+		}
+	}
+	return errs
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// _primaryLayer names the schedule's own shifts, which may be given as a layer of this name instead of at the top level
+const _primaryLayer = "primary"
+
+func checkLayers(s Schedule) error {
+	var errs error
+	for _, name := range s.LayerNames() {
+		l := s.Layers[name]
+		ls := Schedule{Id: l.Id, Shifts: l.Shifts}
+		for _, check := range []func(Schedule) error{
+			checkId,
+			checkShiftListDupes,
+			checkShiftListDupeEmail,
+			checkShiftListSorted,
+			checkShiftListOverlap,
+		} {
+			if err := check(ls); err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("layers.%v: %v", name, err))
+			}
+		}
+	}
+	return errs
+}
+
+func checkLayerOverlap(s Schedule) error {
+	// the schedule's own shifts are listed first, by position, so that no layer's name is mistaken for them
+	top := _primaryLayer
+	if _, ok := s.Layers[_primaryLayer]; ok {
+		top = "the top-level shifts"
+	}
+	names := append([]string{top}, s.LayerNames()...)
+	layers := []ShiftList{s.expanded()}
+	for _, name := range s.LayerNames() {
+		layers = append(layers, s.Layers[name].Shifts)
+	}
+
+	var errs error
+	for i, a := range names {
+		for j := i + 1; j < len(names); j++ {
+			b := names[j]
+			for _, sa := range layers[i] {
+				for _, sb := range layers[j] {
+					if sa.Email == sb.Email && sa.Start.Before(sb.End) && sb.Start.Before(sa.End) {
+						errs = multierr.Append(errs, fmt.Errorf("%v is on call in both %v and %v from %v to %v",
+							sa.Email, a, b, later(sa.Start, sb.Start).Format(_timeFmt), earlier(sa.End, sb.End).Format(_timeFmt)))
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
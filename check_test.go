@@ -59,11 +59,25 @@ func TestShiftListDupes(t *testing.T) {
 }
 
 func TestShiftListDupeEmails(t *testing.T) {
+	t2 := t1.Add(time.Second)
 	expectValid(t, checkShiftListDupeEmail,
 		Schedule{Shifts: ShiftList{Shift{Start: t0, Email: "a"}, Shift{Start: t1, Email: "b"}}},
+		Schedule{Shifts: ShiftList{Shift{Start: t0, End: t1, Email: "a"}, Shift{Start: t2, Email: "a"}}},
 	)
 	expectInvalid(t, checkShiftListDupeEmail,
-		Schedule{Shifts: ShiftList{Shift{Start: t0, Email: "a"}, Shift{Start: t1, Email: "a"}}},
+		Schedule{Shifts: ShiftList{Shift{Start: t0, End: t1, Email: "a"}, Shift{Start: t1, Email: "a", SwappedFrom: "b"}}},
+		Schedule{Shifts: ShiftList{Shift{Start: t0, End: t1, Email: "a"}, Shift{Start: t1, Email: "a"}}},
+	)
+}
+
+func TestShiftListOverlap(t *testing.T) {
+	t2 := t1.Add(time.Second)
+	expectValid(t, checkShiftListOverlap,
+		Schedule{Shifts: ShiftList{{Start: t0, End: t1}, {Start: t1, End: t2}}},
+		Schedule{Shifts: ShiftList{{Start: t0, End: t1}, {Start: t2, End: t2}}},
+	)
+	expectInvalid(t, checkShiftListOverlap,
+		Schedule{Shifts: ShiftList{{Start: t0, End: t2}, {Start: t1, End: t2}}},
 	)
 }
 
@@ -97,6 +111,57 @@ func TestExtendMinLessThanMax(t *testing.T) {
 	)
 }
 
+func TestExtendStartAfterUsers(t *testing.T) {
+	expectValid(t, checkExtendStartAfterUsers,
+		Schedule{},
+		Schedule{Extend: &ExtendOpts{Users: []string{"a"}, StartAfter: map[string]time.Time{"a": t1}}},
+	)
+	expectInvalid(t, checkExtendStartAfterUsers,
+		Schedule{Extend: &ExtendOpts{Users: []string{"a"}, StartAfter: map[string]time.Time{"b": t1}}},
+	)
+}
+
+func TestCheckLayers(t *testing.T) {
+	expectValid(t, checkLayers,
+		Schedule{},
+		Schedule{Layers: map[string]Layer{"secondary": {Id: "_", Shifts: ShiftList{{Start: t0, Email: "a"}, {Start: t1, Email: "b"}}}}},
+		Schedule{Layers: map[string]Layer{"primary": {Id: "_"}}},
+	)
+	expectInvalid(t, checkLayers,
+		Schedule{Layers: map[string]Layer{"secondary": {}}},
+		Schedule{Layers: map[string]Layer{"secondary": {Id: "_", Shifts: ShiftList{{Start: t1, Email: "a"}, {Start: t0, Email: "b"}}}}},
+	)
+}
+
+func TestCheckLayerOverlap(t *testing.T) {
+	t2 := t1.Add(time.Second)
+	a01 := Shift{Email: "a", Start: t0, End: t1}
+	a12 := Shift{Email: "a", Start: t1, End: t2}
+	b01 := Shift{Email: "b", Start: t0, End: t1}
+
+	expectValid(t, checkLayerOverlap,
+		Schedule{},
+		Schedule{Shifts: ShiftList{a01}, Layers: map[string]Layer{"secondary": {Shifts: ShiftList{b01, a12}}}},
+	)
+	expectInvalid(t, checkLayerOverlap,
+		Schedule{Shifts: ShiftList{a01}, Layers: map[string]Layer{"secondary": {Shifts: ShiftList{a01}}}},
+		Schedule{Layers: map[string]Layer{"secondary": {Shifts: ShiftList{a12}}, "shadow": {Shifts: ShiftList{a12}}}},
+	)
+
+	rotation := &Rotation{Anchor: t0, Length: time.Second, Users: []string{"a"}}
+	expectInvalid(t, checkLayerOverlap,
+		Schedule{Rotation: rotation, Layers: map[string]Layer{"secondary": {Shifts: ShiftList{a01}}}},
+	)
+
+	err := checkLayerOverlap(Schedule{Shifts: ShiftList{a01}, Layers: map[string]Layer{"secondary": {Shifts: ShiftList{a01}}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a is on call in both primary and secondary")
+
+	err = checkLayerOverlap(Schedule{Shifts: ShiftList{a01}, Layers: map[string]Layer{"primary": {Shifts: ShiftList{a01}}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a is on call in both the top-level shifts and primary")
+}
+
 func timeFromStr(t *testing.T, s string) time.Time {
 	res, err := time.Parse(time.RFC3339, s)
 	require.NoError(t, err)
@@ -0,0 +1,247 @@
+package stickyshift
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Swap exchanges a's shift at time start with b.
+// if end is zero, a and b trade whole shifts: b takes a's shift, and a takes b's next shift (or b's previous one, if b has
+// none later).
+// otherwise, only the window [start, end) of a's shift is handed to b, as with Cover.
+// each shift that changes hands records whom it was swapped from.
+// in a schedule with a rotation, the shifts may be ones the rotation gives, and those that change hands are kept in
+// the schedule's shifts as overrides of it.
+// the resulting schedule is checked for validity.
+func Swap(s Schedule, a, b string, start, end time.Time) (Schedule, error) {
+	if a == b {
+		return Schedule{}, errors.New("cannot swap a shift with the same user")
+	}
+	sl := s.around(start)
+	i, err := sl.find(a, start)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	var swapped ShiftList
+	if end.IsZero() {
+		j := sl.nearest(b, i)
+		if j < 0 {
+			return Schedule{}, fmt.Errorf("%v has no shift to swap with %v", b, a)
+		}
+		x, y := sl[i], sl[j]
+		x.Email, y.Email = b, a
+		x.SwappedFrom, y.SwappedFrom = a, b
+		swapped = ShiftList{x, y}
+	} else {
+		if end.After(sl[i].End) {
+			return Schedule{}, fmt.Errorf("swap ends at %v, after %v's shift ends at %v", end.Format(_timeFmt), a, sl[i].End.Format(_timeFmt))
+		}
+		swapped = ShiftList{{Email: b, Start: start, End: end, SwappedFrom: a}}
+	}
+
+	if s.Shifts, err = s.override(swapped); err != nil {
+		return Schedule{}, err
+	}
+	if err := check(s); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+// Cover hands the window [start, end) of the schedule to email, as ShiftList.Cover does.
+// in a schedule with a rotation, the window may lie anywhere the rotation covers, and is kept in the schedule's shifts
+// as an override of it.
+// the resulting schedule is checked for validity.
+func Cover(s Schedule, email string, start, end time.Time) (Schedule, error) {
+	var err error
+	if s.Shifts, err = s.override(ShiftList{{Email: email, Start: start, End: end}}); err != nil {
+		return Schedule{}, err
+	}
+	if err := check(s); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+// Cover hands the window [start, end) to email, splitting the shifts around it as needed.
+// it may also fill in a gap between shifts.
+// the window must lie within the list, since a cover cannot move its start or its terminating end.
+func (sl ShiftList) Cover(email string, start, end time.Time) (ShiftList, error) {
+	return sl.cover(Shift{Email: email, Start: start, End: end})
+}
+
+// around returns the shifts of s around time t: its own shifts, over those its rotation gives for a cycle either
+// side of t if it has one
+func (s Schedule) around(t time.Time) ShiftList {
+	if s.Rotation == nil {
+		return s.Shifts.clone()
+	}
+	c := s.Rotation.cycle()
+	return s.Expand(t.Add(-c), t.Add(c))
+}
+
+// override returns the shifts of s with those of top in place of whatever they overlap, keeping their metadata.
+// each shift of top must lie within the schedule's shifts, or anywhere its rotation covers if it has one.
+func (s Schedule) override(top ShiftList) (ShiftList, error) {
+	if s.Rotation == nil {
+		sl := s.Shifts
+		for _, c := range top {
+			var err error
+			if sl, err = sl.cover(c); err != nil {
+				return nil, err
+			}
+		}
+		return sl, nil
+	}
+	for _, c := range top {
+		if !c.Start.Before(c.End) {
+			return nil, fmt.Errorf("cover must start before it ends, but %v >= %v", c.Start.Format(_timeFmt), c.End.Format(_timeFmt))
+		}
+		sl := s.Expand(c.Start, c.End)
+		if len(sl) < 1 || c.Start.Before(sl[0].Start) || c.End.After(sl[len(sl)-1].End) {
+			return nil, fmt.Errorf("cover from %v to %v must lie within the schedule's rotation", c.Start.Format(_timeFmt), c.End.Format(_timeFmt))
+		}
+	}
+	return s.Shifts.overlay(top), nil
+}
+
+// cover hands the window of shift c to its user, keeping its metadata.
+func (sl ShiftList) cover(c Shift) (ShiftList, error) {
+	start, end := c.Start, c.End
+	if len(sl) < 1 {
+		return nil, errors.New("cannot cover a window of an empty shift list")
+	}
+	if !start.Before(end) {
+		return nil, fmt.Errorf("cover must start before it ends, but %v >= %v", start.Format(_timeFmt), end.Format(_timeFmt))
+	}
+	first, last := sl[0].Start, sl[len(sl)-1].End
+	if start.Before(first) || end.After(last) {
+		return nil, fmt.Errorf("cover from %v to %v must lie within the shift list, from %v to %v",
+			start.Format(_timeFmt), end.Format(_timeFmt), first.Format(_timeFmt), last.Format(_timeFmt))
+	}
+
+	return sl.overlay(ShiftList{c}), nil
+}
+
+// Annotate sets the note and ticket of the shift covering time t, leaving either unchanged if it is empty.
+func (sl ShiftList) Annotate(t time.Time, note, ticket string) (ShiftList, error) {
+	i := sl.at(t)
+	if i < 0 {
+		return nil, fmt.Errorf("no shift covers %v", t.Format(_timeFmt))
+	}
+	res := sl.clone()
+	if note != "" {
+		res[i].Note = note
+	}
+	if ticket != "" {
+		res[i].Ticket = ticket
+	}
+	return res, nil
+}
+
+// overlay returns the shifts of sl, with the shifts of top taking precedence wherever they overlap.
+func (sl ShiftList) overlay(top ShiftList) ShiftList {
+	res := sl.clone()
+	for _, s := range top {
+		res = res.split(s.Start).split(s.End)
+	}
+	kept := ShiftList{}
+	for _, s := range res {
+		if !top.covers(s) {
+			kept = append(kept, s)
+		}
+	}
+	kept = append(kept, top...)
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Start.Before(kept[j].Start)
+	})
+	return kept.merge()
+}
+
+// covers reports whether s lies within a single shift of sl.
+func (sl ShiftList) covers(s Shift) bool {
+	for _, c := range sl {
+		if !s.Start.Before(c.Start) && !s.End.After(c.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the index of the shift that email is on at time t.
+func (sl ShiftList) find(email string, t time.Time) (int, error) {
+	i := sl.at(t)
+	if i < 0 {
+		return -1, fmt.Errorf("no shift covers %v", t.Format(_timeFmt))
+	}
+	if sl[i].Email != email {
+		return -1, fmt.Errorf("%v is not on call at %v, %v is", email, t.Format(_timeFmt), sl[i].Email)
+	}
+	return i, nil
+}
+
+// at returns the index of the shift covering time t, or -1 if there is none.
+func (sl ShiftList) at(t time.Time) int {
+	for i, s := range sl {
+		if !t.Before(s.Start) && t.Before(s.End) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nearest returns the index of email's first shift after i, or of its last shift before i if there is none after it.
+// it returns -1 if email has no other shift.
+func (sl ShiftList) nearest(email string, i int) int {
+	for j := i + 1; j < len(sl); j++ {
+		if sl[j].Email == email {
+			return j
+		}
+	}
+	for j := i - 1; j >= 0; j-- {
+		if sl[j].Email == email {
+			return j
+		}
+	}
+	return -1
+}
+
+// split divides the shift covering time t into two shifts meeting at t.
+// the list is returned unchanged if t is already a shift boundary or is not covered.
+func (sl ShiftList) split(t time.Time) ShiftList {
+	i := sl.at(t)
+	if i < 0 || sl[i].Start.Equal(t) {
+		return sl
+	}
+	first, second := sl[i], sl[i]
+	first.End = t
+	second.Start = t
+
+	res := make(ShiftList, 0, len(sl)+1)
+	res = append(res, sl[:i]...)
+	res = append(res, first, second)
+	return append(res, sl[i+1:]...)
+}
+
+// merge joins adjacent shifts of the same user into a single, longer shift, which keeps the metadata of both.
+func (sl ShiftList) merge() ShiftList {
+	res := ShiftList{}
+	for _, s := range sl {
+		if n := len(res); n > 0 && res[n-1].Email == s.Email && res[n-1].End.Equal(s.Start) {
+			res[n-1] = res[n-1].joinMeta(s)
+			res[n-1].End = s.End
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func (sl ShiftList) clone() ShiftList {
+	res := make(ShiftList, len(sl))
+	copy(res, sl)
+	return res
+}
@@ -0,0 +1,332 @@
+package stickyshift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// day returns midnight UTC of the given day of january 2018
+func day(d int) time.Time {
+	return time.Date(2018, time.January, d, 0, 0, 0, 0, time.UTC)
+}
+
+func shifts(emails ...string) ShiftList {
+	sl := ShiftList{}
+	for i, e := range emails {
+		sl = append(sl, Shift{Email: e, Start: day(i + 1), End: day(i + 2)})
+	}
+	return sl
+}
+
+func TestSwap(t *testing.T) {
+	for _, test := range []struct {
+		msg        string
+		in         ShiftList
+		a, b       string
+		start, end time.Time
+		want       ShiftList
+		wantErr    string
+	}{
+		{
+			msg:   "whole shift with b's next shift",
+			in:    shifts("b", "c", "a", "c", "b"),
+			a:     "a",
+			b:     "b",
+			start: day(3).Add(time.Hour),
+			want: ShiftList{
+				{Email: "b", Start: day(1), End: day(2)},
+				{Email: "c", Start: day(2), End: day(3)},
+				{Email: "b", Start: day(3), End: day(4), SwappedFrom: "a"},
+				{Email: "c", Start: day(4), End: day(5)},
+				{Email: "a", Start: day(5), End: day(6), SwappedFrom: "b"},
+			},
+		},
+		{
+			msg:   "whole shift with b's previous shift",
+			in:    shifts("b", "c", "a"),
+			a:     "a",
+			b:     "b",
+			start: day(3),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(2), SwappedFrom: "b"},
+				{Email: "c", Start: day(2), End: day(3)},
+				{Email: "b", Start: day(3), End: day(4), SwappedFrom: "a"},
+			},
+		},
+		{
+			msg:   "merges adjacent shifts",
+			in:    shifts("a", "c", "a", "b"),
+			a:     "a",
+			b:     "c",
+			start: day(3),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(3), SwappedFrom: "c"},
+				{Email: "c", Start: day(3), End: day(4), SwappedFrom: "a"},
+				{Email: "b", Start: day(4), End: day(5)},
+			},
+		},
+		{
+			msg:   "partial window",
+			in:    shifts("a", "c"),
+			a:     "a",
+			b:     "b",
+			start: day(1).Add(6 * time.Hour),
+			end:   day(1).Add(12 * time.Hour),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(1).Add(6 * time.Hour)},
+				{Email: "b", Start: day(1).Add(6 * time.Hour), End: day(1).Add(12 * time.Hour), SwappedFrom: "a"},
+				{Email: "a", Start: day(1).Add(12 * time.Hour), End: day(2)},
+				{Email: "c", Start: day(2), End: day(3)},
+			},
+		},
+		{
+			msg:   "partial window at end of shift merges with next",
+			in:    shifts("a", "b"),
+			a:     "a",
+			b:     "b",
+			start: day(1).Add(12 * time.Hour),
+			end:   day(2),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(1).Add(12 * time.Hour)},
+				{Email: "b", Start: day(1).Add(12 * time.Hour), End: day(3), SwappedFrom: "a"},
+			},
+		},
+		{
+			msg:     "same user",
+			in:      shifts("a", "b"),
+			a:       "a",
+			b:       "a",
+			start:   day(1),
+			wantErr: "same user",
+		},
+		{
+			msg:     "not covered",
+			in:      shifts("a", "b"),
+			a:       "a",
+			b:       "b",
+			start:   day(10),
+			wantErr: "no shift covers",
+		},
+		{
+			msg:     "wrong user",
+			in:      shifts("a", "b"),
+			a:       "b",
+			b:       "a",
+			start:   day(1),
+			wantErr: "b is not on call",
+		},
+		{
+			msg:     "b has no shift",
+			in:      shifts("a", "c"),
+			a:       "a",
+			b:       "b",
+			start:   day(1),
+			wantErr: "b has no shift",
+		},
+		{
+			msg:     "window ends before it starts",
+			in:      shifts("a", "c"),
+			a:       "a",
+			b:       "b",
+			start:   day(1).Add(time.Hour),
+			end:     day(1),
+			wantErr: "cover must start before it ends",
+		},
+		{
+			msg:     "window past end of shift",
+			in:      shifts("a", "c"),
+			a:       "a",
+			b:       "b",
+			start:   day(1),
+			end:     day(3),
+			wantErr: "after a's shift ends",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			in := Schedule{Id: "_", Shifts: test.in}
+			orig := test.in.clone()
+			res, err := Swap(in, test.a, test.b, test.start, test.end)
+			assert.Equal(t, orig, test.in, "input should not be modified")
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, res.Shifts)
+		})
+	}
+}
+
+func TestCover(t *testing.T) {
+	for _, test := range []struct {
+		msg        string
+		in         ShiftList
+		start, end time.Time
+		want       ShiftList
+		wantErr    string
+	}{
+		{
+			msg:   "inside a shift",
+			in:    shifts("a", "b"),
+			start: day(1).Add(18 * time.Hour),
+			end:   day(2).Add(9 * time.Hour),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(1).Add(18 * time.Hour)},
+				{Email: "x", Start: day(1).Add(18 * time.Hour), End: day(2).Add(9 * time.Hour)},
+				{Email: "b", Start: day(2).Add(9 * time.Hour), End: day(3)},
+			},
+		},
+		{
+			msg:   "whole list",
+			in:    shifts("a", "b"),
+			start: day(1),
+			end:   day(3),
+			want:  ShiftList{{Email: "x", Start: day(1), End: day(3)}},
+		},
+		{
+			msg:   "fills a gap",
+			in:    ShiftList{{Email: "a", Start: day(1), End: day(2)}, {Email: "b", Start: day(3), End: day(4)}},
+			start: day(1).Add(12 * time.Hour),
+			end:   day(3).Add(12 * time.Hour),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(1).Add(12 * time.Hour)},
+				{Email: "x", Start: day(1).Add(12 * time.Hour), End: day(3).Add(12 * time.Hour)},
+				{Email: "b", Start: day(3).Add(12 * time.Hour), End: day(4)},
+			},
+		},
+		{
+			msg:   "end of list",
+			in:    shifts("a", "b"),
+			start: day(2).Add(time.Hour),
+			end:   day(3),
+			want: ShiftList{
+				{Email: "a", Start: day(1), End: day(2)},
+				{Email: "b", Start: day(2), End: day(2).Add(time.Hour)},
+				{Email: "x", Start: day(2).Add(time.Hour), End: day(3)},
+			},
+		},
+		{
+			msg:     "empty",
+			in:      ShiftList{},
+			start:   day(1),
+			end:     day(2),
+			wantErr: "empty shift list",
+		},
+		{
+			msg:     "backwards",
+			in:      shifts("a"),
+			start:   day(2),
+			end:     day(1),
+			wantErr: "must start before it ends",
+		},
+		{
+			msg:     "before start of list",
+			in:      shifts("a"),
+			start:   day(0),
+			end:     day(1).Add(time.Hour),
+			wantErr: "must lie within the shift list",
+		},
+		{
+			msg:     "after end of list",
+			in:      shifts("a"),
+			start:   day(1).Add(time.Hour),
+			end:     day(3),
+			wantErr: "must lie within the shift list",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			orig := test.in.clone()
+			res, err := test.in.Cover("x", test.start, test.end)
+			assert.Equal(t, orig, test.in, "input should not be modified")
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, res)
+		})
+	}
+}
+
+func TestEditRotation(t *testing.T) {
+	s := Schedule{Id: "_", Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Users: []string{"a", "b"}}}
+
+	res, err := Cover(s, "x", day(2).Add(6*time.Hour), day(2).Add(12*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, ShiftList{{Email: "x", Start: day(2).Add(6 * time.Hour), End: day(2).Add(12 * time.Hour)}}, res.Shifts,
+		"a cover should be kept as an override of the rotation")
+
+	res, err = Swap(s, "a", "b", day(3).Add(time.Hour), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, ShiftList{
+		{Email: "b", Start: day(3), End: day(4), SwappedFrom: "a"},
+		{Email: "a", Start: day(4), End: day(5), SwappedFrom: "b"},
+	}, res.Shifts, "whole shifts the rotation gives should be traded as overrides")
+
+	res, err = Swap(res, "a", "c", day(4), day(4).Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, ShiftList{
+		{Email: "b", Start: day(3), End: day(4), SwappedFrom: "a"},
+		{Email: "c", Start: day(4), End: day(4).Add(time.Hour), SwappedFrom: "a"},
+		{Email: "a", Start: day(4).Add(time.Hour), End: day(5), SwappedFrom: "b"},
+	}, res.Shifts, "an override should be swapped like any other shift")
+
+	_, err = Swap(s, "a", "b", day(2), time.Time{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b is")
+
+	_, err = Cover(s, "x", day(2), day(1))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must start before it ends")
+}
+
+func TestAnnotate(t *testing.T) {
+	sl := shifts("a", "b")
+	res, err := sl.Annotate(day(2).Add(time.Hour), "covering", "OPS-1")
+	require.NoError(t, err)
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: day(1), End: day(2)},
+		{Email: "b", Start: day(2), End: day(3), Note: "covering", Ticket: "OPS-1"},
+	}, res)
+	assert.Equal(t, shifts("a", "b"), sl, "input should not be modified")
+
+	res, err = res.Annotate(day(2), "", "OPS-2")
+	require.NoError(t, err)
+	assert.Equal(t, "covering; ticket OPS-2", res[1].Annotation())
+
+	_, err = sl.Annotate(day(5), "_", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no shift covers")
+}
+
+func TestSplit(t *testing.T) {
+	sl := shifts("a", "b")
+	assert.Equal(t, sl, sl.split(day(1)), "boundary")
+	assert.Equal(t, sl, sl.split(day(5)), "not covered")
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: day(1), End: day(1).Add(time.Hour)},
+		{Email: "a", Start: day(1).Add(time.Hour), End: day(2)},
+		{Email: "b", Start: day(2), End: day(3)},
+	}, sl.split(day(1).Add(time.Hour)))
+}
+
+func TestMerge(t *testing.T) {
+	assert.Equal(t, ShiftList{}, ShiftList{}.merge())
+	assert.Equal(t, shifts("a", "b", "a"), shifts("a", "b", "a").merge())
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: day(1), End: day(3)},
+		{Email: "b", Start: day(3), End: day(4)},
+	}, shifts("a", "a", "b").merge())
+	noted := shifts("a", "a", "a")
+	noted[0].Note, noted[0].SwappedFrom = "x", "b"
+	noted[1].Note, noted[1].Ticket = "y", "OPS-1"
+	noted[2].Note, noted[2].SwappedFrom = "x", "c"
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: day(1), End: day(4), Note: "x; y", Ticket: "OPS-1", SwappedFrom: "b, c"},
+	}, noted.merge(), "the metadata of merged shifts should be kept")
+}
@@ -0,0 +1,72 @@
+package stickyshift
+
+import (
+	"time"
+)
+
+// load returns the total time each user is on call in sl.
+func (sl ShiftList) load() map[string]time.Duration {
+	res := map[string]time.Duration{}
+	for _, s := range sl {
+		res[s.Email] += s.End.Sub(s.Start)
+	}
+	return res
+}
+
+// _preferencePenalty is how many times its own length a shift against its user's preferences adds to their time on
+// call when picking the fairest user, so that preferences are honored until they would make the schedule too uneven.
+const _preferencePenalty = 2
+
+// fairest picks the user from pool who should take shift i: the one with the least time on call, counting a shift
+// against their preferences as _preferencePenalty times its length more, and preferring users who are not already on
+// call right before or after it.
+// ties go to whoever comes first in pool. it returns "" if pool is empty.
+func (sl ShiftList) fairest(pool []string, i int, prefs Preferences) string {
+	load := sl.load()
+	score := func(u string) time.Duration {
+		s := sl[i]
+		s.Email = u
+		if prefs.against(s) != "" {
+			return load[u] + _preferencePenalty*s.End.Sub(s.Start)
+		}
+		return load[u]
+	}
+	best, bestAdjacent := "", false
+	for _, u := range pool {
+		adjacent := (i > 0 && sl[i-1].Email == u) || (i < len(sl)-1 && sl[i+1].Email == u)
+		switch {
+		case best == "":
+		case bestAdjacent && !adjacent:
+		case adjacent && !bestAdjacent:
+			continue
+		case score(u) >= score(best):
+			continue
+		}
+		best, bestAdjacent = u, adjacent
+	}
+	return best
+}
+
+// pool returns the users who may take shifts in s starting at time t: the users to extend the schedule with if there
+// are any, otherwise everyone who has a shift in it, including those of its rotation.
+// users who are still ramping up at t are left out.
+func (s Schedule) pool(t time.Time) []string {
+	if s.Extend != nil && len(s.Extend.Users) > 0 {
+		res := []string{}
+		for _, u := range s.Extend.Users {
+			if after, ok := s.Extend.StartAfter[u]; !ok || !t.Before(after) {
+				res = append(res, u)
+			}
+		}
+		return res
+	}
+	seen := map[string]bool{}
+	res := []string{}
+	for _, sh := range s.expanded() {
+		if !seen[sh.Email] {
+			seen[sh.Email] = true
+			res = append(res, sh.Email)
+		}
+	}
+	return res
+}
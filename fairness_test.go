@@ -0,0 +1,31 @@
+package stickyshift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFairest(t *testing.T) {
+	sl := shifts("a", "a", "b", "_", "c")
+	assert.Equal(t, "", sl.fairest(nil, 3, nil))
+	assert.Equal(t, "b", sl.fairest([]string{"a", "b"}, 4, nil), "least loaded")
+	assert.Equal(t, "a", sl.fairest([]string{"a", "b"}, 3, nil), "neighbours avoided")
+	assert.Equal(t, "b", sl.fairest([]string{"b", "c"}, 3, nil), "ties go to first")
+	assert.Equal(t, "x", sl.fairest([]string{"b", "x"}, 0, nil), "users without shifts have no load")
+
+	against := Preferences{"b": {StartDays: []string{"31"}}}
+	assert.Equal(t, "c", sl.fairest([]string{"b", "c"}, 3, against), "a shift against preferences counts as more time on call")
+	assert.Equal(t, "b", shifts("c", "c", "c", "_", "b").fairest([]string{"b", "c"}, 3, against), "preferences give way to fairness")
+}
+
+func TestPool(t *testing.T) {
+	assert.Equal(t, []string{}, Schedule{}.pool(day(1)))
+	assert.Equal(t, []string{"a", "b"}, Schedule{Shifts: shifts("a", "b", "a")}.pool(day(1)))
+	assert.Equal(t, []string{"c"}, Schedule{Extend: &ExtendOpts{Users: []string{"c"}}, Shifts: shifts("a")}.pool(day(1)))
+
+	s := Schedule{Extend: &ExtendOpts{Users: []string{"a", "b"}, StartAfter: map[string]time.Time{"b": day(2)}}}
+	assert.Equal(t, []string{"a"}, s.pool(day(1)), "ramping up")
+	assert.Equal(t, []string{"a", "b"}, s.pool(day(2)), "ramped up")
+}
@@ -0,0 +1,182 @@
+package stickyshift
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Constraints limit who may be given a shift by Generate
+	Constraints struct {
+		// Unavailable holds the times each user cannot be on call
+		Unavailable map[string][]Window `yaml:"unavailable,omitempty"`
+		// MinRest is the least time a user must have off between two of their shifts
+		MinRest time.Duration `yaml:"minRest,omitempty"`
+		// MaxShiftsPerMonth caps how many shifts a user may start in a calendar month. there is no cap if it is zero.
+		MaxShiftsPerMonth int `yaml:"maxShiftsPerMonth,omitempty"`
+		// Busy holds the shifts users have in other schedules, which they must not be given overlapping shifts with.
+		// Generate adds the shifts of the schedule's own layers.
+		Busy ShiftList `yaml:"-"`
+		// Preferences are weighed against fairness when choosing among the users allowed to take a shift
+		Preferences Preferences `yaml:"-"`
+	}
+
+	// Window represents a span of time
+	Window struct {
+		Start time.Time `yaml:"start"`
+		End   time.Time `yaml:"end"`
+	}
+
+	// Assignment records a shift given out by Generate, and why it went to its user
+	Assignment struct {
+		Shift
+		Reason string
+	}
+)
+
+// ReadConstraints loads constraints from the given yaml file
+func ReadConstraints(f string) (c Constraints, err error) {
+	bs, err := ioutil.ReadFile(f)
+	if err != nil {
+		return
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	if err = dec.Decode(&c); err != nil {
+		return Constraints{}, err
+	}
+	return c, nil
+}
+
+// Generate fills the schedule with shifts of the given length, from the end of its last shift until at least until.
+// each shift goes to the user with the least time on call among those the constraints allow to take it,
+// where a shift against a user's preferences counts against them as extra time on call.
+// it fails if a shift cannot be given to anyone.
+func Generate(s Schedule, length time.Duration, until time.Time, c Constraints) (Schedule, []Assignment, error) {
+	if length <= 0 {
+		return Schedule{}, nil, fmt.Errorf("shift length must be positive, but found %v", length)
+	}
+	if len(s.Shifts) < 1 {
+		return Schedule{}, nil, errors.New("cannot generate shifts for a schedule without any to start from")
+	}
+
+	// the schedule's own layers keep their users as busy as other schedules do
+	c.Busy = append(c.Busy.clone(), s.busyBesides("")...)
+	sl := s.Shifts.clone()
+	res := []Assignment{}
+	for start := sl[len(sl)-1].End; start.Before(until); start = start.Add(length) {
+		slot := Shift{Start: start, End: start.Add(length)}
+		sl = append(sl, slot)
+		i := len(sl) - 1
+
+		eligible, excluded := []string{}, []string{}
+		for _, u := range s.pool(start) {
+			if why := c.violation(sl[:i], u, slot); why != "" {
+				excluded = append(excluded, fmt.Sprintf("%v (%v)", u, why))
+				continue
+			}
+			eligible = append(eligible, u)
+		}
+
+		u := sl.fairest(eligible, i, c.Preferences)
+		if u == "" {
+			return Schedule{}, nil, fmt.Errorf("nobody can take the shift from %v to %v: %v",
+				slot.Start.Format(_timeFmt), slot.End.Format(_timeFmt), strings.Join(excluded, ", "))
+		}
+		sl[i].Email = u
+		res = append(res, Assignment{sl[i], explain(sl[:i], sl[i], eligible, excluded, c.Preferences)})
+	}
+
+	s.Shifts = sl.merge()
+	if err := check(s); err != nil {
+		return Schedule{}, nil, err
+	}
+	return s, res, nil
+}
+
+// violation returns why user u may not take shift s, given the shifts before it, or "" if they may.
+func (c Constraints) violation(before ShiftList, u string, s Shift) string {
+	for _, w := range c.Unavailable[u] {
+		if w.Start.Before(s.End) && s.Start.Before(w.End) {
+			return fmt.Sprintf("unavailable from %v to %v", w.Start.Format(_timeFmt), w.End.Format(_timeFmt))
+		}
+	}
+	for _, b := range c.Busy {
+		if b.Email == u && b.Start.Before(s.End) && s.Start.Before(b.End) {
+			return fmt.Sprintf("on call elsewhere from %v to %v", b.Start.Format(_timeFmt), b.End.Format(_timeFmt))
+		}
+	}
+
+	theirs := ShiftList{}
+	for _, o := range append(before.clone(), c.Busy...) {
+		if o.Email == u {
+			theirs = append(theirs, o)
+		}
+	}
+	if c.MinRest > 0 {
+		for _, o := range theirs {
+			if o.End.Add(c.MinRest).After(s.Start) && s.End.Add(c.MinRest).After(o.Start) {
+				return fmt.Sprintf("needs %v of rest around their shift from %v to %v", c.MinRest, o.Start.Format(_timeFmt), o.End.Format(_timeFmt))
+			}
+		}
+	}
+	if c.MaxShiftsPerMonth > 0 {
+		n := 0
+		y, m, _ := s.Start.Date()
+		for _, o := range before {
+			if oy, om, _ := o.Start.In(s.Start.Location()).Date(); o.Email == u && oy == y && om == m {
+				n++
+			}
+		}
+		if n >= c.MaxShiftsPerMonth {
+			return fmt.Sprintf("already has %v shifts in %v %v", n, m, y)
+		}
+	}
+	return ""
+}
+
+// explain says why shift s went to its user out of the eligible ones, given the shifts before it.
+// eligible users with less time on call were passed over either for being on call next to it, or for its going
+// against their preferences.
+func explain(before ShiftList, s Shift, eligible, excluded []string, prefs Preferences) string {
+	u, load := s.Email, before.load()
+	reason := fmt.Sprintf("%v is the only eligible user", u)
+	if len(eligible) > 1 {
+		adjacent, passed := false, []string{}
+		for _, e := range eligible {
+			if load[e] >= load[u] {
+				continue
+			}
+			o := s
+			o.Email = e
+			if why := prefs.against(o); why != "" {
+				passed = append(passed, fmt.Sprintf("%v (%v)", e, why))
+			} else {
+				adjacent = true
+			}
+		}
+		reason = fmt.Sprintf("%v has the least time on call (%v) of %v eligible users", u, load[u], len(eligible))
+		if adjacent {
+			reason = fmt.Sprintf("%v has the least time on call (%v) of the eligible users not on call next to it", u, load[u])
+		}
+		if len(passed) > 0 {
+			sort.Strings(passed)
+			reason += " once preferences are weighed; passed over " + strings.Join(passed, ", ")
+		}
+	}
+	if len(excluded) > 0 {
+		sort.Strings(excluded)
+		reason += "; excluded " + strings.Join(excluded, ", ")
+	}
+	if why := prefs.against(s); why != "" {
+		reason += fmt.Sprintf("; against their preference: %v", why)
+	}
+	return reason
+}
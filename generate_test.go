@@ -0,0 +1,186 @@
+package stickyshift
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConstraints(t *testing.T) {
+	_, err := ReadConstraints("💥")
+	assert.Error(t, err)
+
+	f := tmp(t, `
+unavailable:
+  a:
+    - start: 2018-01-01T00:00:00Z
+      end: 2018-01-02T00:00:00Z
+minRest: 24h
+maxShiftsPerMonth: 2
+`)
+	defer os.Remove(f)
+	c, err := ReadConstraints(f)
+	require.NoError(t, err)
+	assert.Equal(t, Constraints{
+		Unavailable:       map[string][]Window{"a": {{Start: day(1), End: day(2)}}},
+		MinRest:           24 * time.Hour,
+		MaxShiftsPerMonth: 2,
+	}, c)
+
+	f = tmp(t, `_: _`)
+	defer os.Remove(f)
+	_, err = ReadConstraints(f)
+	assert.Error(t, err)
+}
+
+func TestGenerate(t *testing.T) {
+	ext := &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b", "c"}}
+	for _, test := range []struct {
+		msg         string
+		in          Schedule
+		length      time.Duration
+		until       time.Time
+		c           Constraints
+		want        ShiftList
+		wantReasons []string
+		wantErr     string
+	}{
+		{
+			msg:    "round robin by load",
+			in:     Schedule{Id: "_", Extend: ext, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(5),
+			want:   shifts("a", "b", "c", "a"),
+			wantReasons: []string{
+				"b has the least time on call (0s) of 3 eligible users",
+				"c has the least time on call (0s) of 3 eligible users",
+				"a has the least time on call (24h0m0s) of 3 eligible users",
+			},
+		},
+		{
+			msg:    "unavailable",
+			in:     Schedule{Id: "_", Extend: ext, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(3),
+			c:      Constraints{Unavailable: map[string][]Window{"b": {{Start: day(2).Add(time.Hour), End: day(2).Add(2 * time.Hour)}}}},
+			want:   shifts("a", "c"),
+			wantReasons: []string{
+				"c has the least time on call (0s) of 2 eligible users; excluded b (unavailable from 2018-01-02T01:00:00Z to 2018-01-02T02:00:00Z)",
+			},
+		},
+		{
+			msg:    "preferences",
+			in:     Schedule{Id: "_", Extend: ext, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(4),
+			c: Constraints{Preferences: Preferences{
+				"b": {StartDays: []string{"3-31"}},
+				"c": {Avoid: []Window{{Start: day(2), End: day(4)}}},
+			}},
+			want: shifts("a", "b", "a"),
+			wantReasons: []string{
+				"b has the least time on call (0s) of 3 eligible users; against their preference: prefers to start on days 3-31",
+				"a has the least time on call (24h0m0s) of 3 eligible users once preferences are weighed; " +
+					"passed over c (would rather avoid 2018-01-02T00:00:00Z to 2018-01-04T00:00:00Z)",
+			},
+		},
+		{
+			msg:    "preferences give way to fairness",
+			in:     Schedule{Id: "_", Extend: ext, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(9),
+			c: Constraints{Preferences: Preferences{
+				"b": {StartDays: []string{"1-3"}},
+				"c": {StartDays: []string{"1-3"}},
+			}},
+			want: shifts("a", "b", "c", "a", "b", "a", "c", "a"),
+		},
+		{
+			msg:    "busy elsewhere",
+			in:     Schedule{Id: "_", Extend: ext, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(3),
+			c:      Constraints{Busy: ShiftList{{Email: "b", Start: day(2), End: day(3)}}},
+			want:   shifts("a", "c"),
+			wantReasons: []string{
+				"c has the least time on call (0s) of 2 eligible users; excluded b (on call elsewhere from 2018-01-02T00:00:00Z to 2018-01-03T00:00:00Z)",
+			},
+		},
+		{
+			msg: "busy in a layer",
+			in: Schedule{Id: "_", Extend: ext, Shifts: shifts("a"), Layers: map[string]Layer{
+				"secondary": {Id: "s", Shifts: ShiftList{{Email: "b", Start: day(2), End: day(3)}}},
+			}},
+			length: 24 * time.Hour,
+			until:  day(3),
+			want:   shifts("a", "c"),
+			wantReasons: []string{
+				"c has the least time on call (0s) of 2 eligible users; excluded b (on call elsewhere from 2018-01-02T00:00:00Z to 2018-01-03T00:00:00Z)",
+			},
+		},
+		{
+			msg:    "only one eligible",
+			in:     Schedule{Id: "_", Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b"}}, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(3),
+			c:      Constraints{MinRest: time.Hour},
+			want:   shifts("a", "b"),
+			wantReasons: []string{
+				"b is the only eligible user; excluded a (needs 1h0m0s of rest around their shift from 2018-01-01T00:00:00Z to 2018-01-02T00:00:00Z)",
+			},
+		},
+		{
+			msg:    "min rest",
+			in:     Schedule{Id: "_", Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b"}}, Shifts: shifts("a")},
+			length: 24 * time.Hour,
+			until:  day(3),
+			c:      Constraints{MinRest: time.Hour, Busy: ShiftList{{Email: "b", Start: day(3).Add(30 * time.Minute), End: day(4)}}},
+			wantErr: "nobody can take the shift from 2018-01-02T00:00:00Z to 2018-01-03T00:00:00Z: " +
+				"a (needs 1h0m0s of rest around their shift from 2018-01-01T00:00:00Z to 2018-01-02T00:00:00Z), " +
+				"b (needs 1h0m0s of rest around their shift from 2018-01-03T00:30:00Z to 2018-01-04T00:00:00Z)",
+		},
+		{
+			msg:     "max shifts per month",
+			in:      Schedule{Id: "_", Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b"}}, Shifts: shifts("a", "b")},
+			length:  24 * time.Hour,
+			until:   day(4),
+			c:       Constraints{MaxShiftsPerMonth: 1},
+			wantErr: "a (already has 1 shifts in January 2018)",
+		},
+		{
+			msg:     "bad length",
+			in:      Schedule{Id: "_", Shifts: shifts("a")},
+			until:   day(3),
+			wantErr: "must be positive",
+		},
+		{
+			msg:     "nothing to start from",
+			in:      Schedule{Id: "_"},
+			length:  time.Hour,
+			until:   day(3),
+			wantErr: "without any to start from",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			res, as, err := Generate(test.in, test.length, test.until, test.c)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, res.Shifts)
+			if test.wantReasons == nil {
+				return
+			}
+			reasons := []string{}
+			for _, a := range as {
+				reasons = append(reasons, a.Reason)
+			}
+			assert.Equal(t, test.wantReasons, reasons)
+		})
+	}
+}
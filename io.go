@@ -1,12 +1,16 @@
 package stickyshift
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"sort"
+	"strings"
 	"time"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 type (
@@ -15,6 +19,22 @@ type (
 		Id     string      `yaml:"id"`
 		Extend *ExtendOpts `yaml:"extend,omitempty"`
 		Shifts ShiftList   `yaml:"shifts"`
+		// Rotation generates shifts, which the explicit Shifts take precedence over
+		Rotation *Rotation `yaml:"rotation,omitempty"`
+		// Layers holds named sequences of shifts run alongside the primary one, such as a secondary or a shadow
+		Layers map[string]Layer `yaml:"layers,omitempty"`
+		// RosterFile is the path of the team's roster, relative to the schedule file, such as roster.yaml
+		RosterFile string `yaml:"roster,omitempty"`
+		// Roster is loaded from RosterFile by Read, which resolves the handles in the schedule to emails
+		Roster Roster `yaml:"-"`
+		// primaryLayer records that Read took Id and Shifts from layers.primary, where Write puts them back
+		primaryLayer bool
+	}
+
+	// Layer represents a sequence of shifts alongside the primary one, synced to its own pagerduty schedule
+	Layer struct {
+		Id     string    `yaml:"id"`
+		Shifts ShiftList `yaml:"shifts"`
 	}
 
 	// Shift represents an oncall shift
@@ -22,6 +42,28 @@ type (
 		Email string
 		Start time.Time
 		End   time.Time
+		// Note, Ticket and SwappedFrom record why the shift is what it is, such as a link to the request for a swap
+		Note        string
+		Ticket      string
+		SwappedFrom string
+	}
+
+	// listShift is the form a Shift takes in the explicit-interval list syntax
+	listShift struct {
+		Email       string    `yaml:"email"`
+		Start       time.Time `yaml:"start"`
+		End         time.Time `yaml:"end"`
+		Note        string    `yaml:"note,omitempty"`
+		Ticket      string    `yaml:"ticket,omitempty"`
+		SwappedFrom string    `yaml:"swappedFrom,omitempty"`
+	}
+
+	// mapShift is the form the value of a shift with metadata takes in the ordered map syntax
+	mapShift struct {
+		Email       string `yaml:"email"`
+		Note        string `yaml:"note,omitempty"`
+		Ticket      string `yaml:"ticket,omitempty"`
+		SwappedFrom string `yaml:"swappedFrom,omitempty"`
 	}
 
 	ShiftList []Shift
@@ -31,54 +73,127 @@ type (
 		MinDays int      `yaml:"minDays"`
 		MaxDays int      `yaml:"maxDays"`
 		Users   []string `yaml:"users"`
+		// StartAfter holds the time from which a new user may be given shifts
+		StartAfter map[string]time.Time `yaml:"startAfter,omitempty"`
 	}
 )
 
 const (
 	_shiftListEnder = "TBD"
-	_timeFmt        = time.RFC3339
+	// _shiftListGap ends the previous shift without starting a new one, leaving pagerduty's own rotation on call
+	_shiftListGap = "ROTATION"
+	_timeFmt      = time.RFC3339
+	// _indent is the indent of new files, and of those whose own indent cannot be told
+	_indent = 2
+
+	// _lineMarker starts a comment that stands in for a comment or blank line of the original file while it is re-encoded,
+	// since the yaml encoder has no notion of blank lines, and lays out comments its own way.
+	_lineMarker = "#stickyshift:"
 )
 
 // UnmarshalYAML deserializes a yaml input map into a ShiftList
 // a custom unmarshaller is used because we care about the order of the keys in the input.
-func (sl *ShiftList) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	m := yaml.MapSlice{}
-	if err := unmarshal(&m); err != nil {
-		return err
+// a shift with metadata has a map in place of its email, such as `t0: {email: x, ticket: OPS-1}`.
+// shifts may also be given as a list of explicit intervals, such as `- {email: x, start: t0, end: t1}`.
+func (sl *ShiftList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.SequenceNode {
+		return sl.unmarshalList(n)
 	}
-	for i, mi := range m {
-		k, ok := mi.Key.(string)
-		if !ok {
+	if n.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %v: shifts must be a yaml map or list", n.Line)
+	}
+	// open is whether the last shift appended is still waiting for the next key to end it
+	open := false
+	for i := 0; i < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
 			return errors.New("shift time is not a yaml string")
 		}
-		v, ok := mi.Value.(string)
-		if !ok {
+		ms := mapShift{Email: v.Value}
+		if v.Kind == yaml.MappingNode && i < len(n.Content)-2 {
+			var err error
+			if ms, err = decodeMapShift(v); err != nil {
+				return err
+			}
+		} else if v.Kind != yaml.ScalarNode || v.ShortTag() != "!!str" {
 			return errors.New("shift email is not a yaml string")
 		}
 
-		s, err := kvToShift(k, v)
+		s, err := kvToShift(k.Value, ms.Email)
 		if err != nil {
 			return err
 		}
-		if i > 0 {
-			(*sl)[i-1].End = s.Start
+		s.Note, s.Ticket, s.SwappedFrom = ms.Note, ms.Ticket, ms.SwappedFrom
+		if open {
+			(*sl)[len(*sl)-1].End = s.Start
+			open = false
 		}
 
-		if i < len(m)-1 {
+		if i < len(n.Content)-2 && v.Value != _shiftListGap {
 			*sl = append(*sl, s)
+			open = true
 		}
 
-		if i == len(m)-1 {
-			if v != _shiftListEnder {
-				return fmt.Errorf("last shift must have user %q, but found %q", _shiftListEnder, v)
+		if i == len(n.Content)-2 {
+			if v.Value != _shiftListEnder {
+				return fmt.Errorf("last shift must have user %q, but found %q", _shiftListEnder, v.Value)
 			}
 		}
 	}
 	return nil
 }
 
+var (
+	_listShiftFields = map[string]bool{"email": true, "start": true, "end": true, "note": true, "ticket": true, "swappedFrom": true}
+	_mapShiftFields  = map[string]bool{"email": true, "note": true, "ticket": true, "swappedFrom": true}
+)
+
+func (sl *ShiftList) unmarshalList(n *yaml.Node) error {
+	for _, item := range n.Content {
+		if item.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %v: shift is not a yaml map", item.Line)
+		}
+		for i := 0; i < len(item.Content); i += 2 {
+			if k := item.Content[i].Value; !_listShiftFields[k] {
+				return fmt.Errorf("line %v: field %v not found in shift", item.Content[i].Line, k)
+			}
+		}
+		ls := listShift{}
+		if err := item.Decode(&ls); err != nil {
+			return err
+		}
+		switch {
+		case ls.Email == "":
+			return fmt.Errorf("line %v: shift is missing `email` field", item.Line)
+		case ls.Start.IsZero() || ls.End.IsZero():
+			return fmt.Errorf("line %v: shift must have both `start` and `end` fields", item.Line)
+		case !ls.Start.Before(ls.End):
+			return fmt.Errorf("line %v: shift must start before it ends", item.Line)
+		}
+		*sl = append(*sl, Shift(ls))
+	}
+	return nil
+}
+
+// decodeMapShift decodes the map given in place of the email of a shift with metadata
+func decodeMapShift(v *yaml.Node) (mapShift, error) {
+	for i := 0; i < len(v.Content); i += 2 {
+		if k := v.Content[i].Value; !_mapShiftFields[k] {
+			return mapShift{}, fmt.Errorf("line %v: field %v not found in shift", v.Content[i].Line, k)
+		}
+	}
+	ms := mapShift{}
+	if err := v.Decode(&ms); err != nil {
+		return mapShift{}, err
+	}
+	if ms.Email == "" {
+		return mapShift{}, fmt.Errorf("line %v: shift is missing `email` field", v.Line)
+	}
+	return ms, nil
+}
+
 func kvToShift(k, v string) (s Shift, err error) {
-	t, err := time.Parse(time.RFC3339, k)
+	t, err := time.Parse(_timeFmt, k)
 	if err != nil {
 		return
 	}
@@ -87,15 +202,83 @@ func kvToShift(k, v string) (s Shift, err error) {
 	return
 }
 
+// promotePrimary makes an explicit layers.primary the schedule's own id and shifts
+func (s Schedule) promotePrimary() (Schedule, error) {
+	l, ok := s.Layers[_primaryLayer]
+	if !ok {
+		return s, nil
+	}
+	if s.Id != "" || len(s.Shifts) > 0 {
+		return Schedule{}, fmt.Errorf("layers.%v and the top-level `id` and `shifts` cannot both be given", _primaryLayer)
+	}
+	layers := map[string]Layer{}
+	for name, l := range s.Layers {
+		if name != _primaryLayer {
+			layers[name] = l
+		}
+	}
+	if len(layers) == 0 {
+		layers = nil
+	}
+	s.Id, s.Shifts, s.Layers, s.primaryLayer = l.Id, l.Shifts, layers, true
+	return s, nil
+}
+
+// demotePrimary undoes promotePrimary, for writing the schedule back as it was read
+func (s Schedule) demotePrimary() Schedule {
+	if !s.primaryLayer {
+		return s
+	}
+	layers := map[string]Layer{_primaryLayer: {Id: s.Id, Shifts: s.Shifts}}
+	for name, l := range s.Layers {
+		layers[name] = l
+	}
+	s.Id, s.Shifts, s.Layers = "", nil, layers
+	return s
+}
+
+// deleteKeys removes the given keys from mapping n
+func deleteKeys(n *yaml.Node, keys ...string) {
+	content := []*yaml.Node{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !contains(keys, n.Content[i].Value) {
+			content = append(content, n.Content[i], n.Content[i+1])
+		}
+	}
+	n.Content = content
+}
+
+// LayerNames returns the names of the schedule's layers, in sorted order
+func (s Schedule) LayerNames() []string {
+	res := make([]string, 0, len(s.Layers))
+	for name := range s.Layers {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
 // Read loads a schedule from the given yaml file
 func Read(f string) (s Schedule, err error) {
 	bs, err := ioutil.ReadFile(f)
 	if err != nil {
 		return
 	}
-	if err = yaml.UnmarshalStrict(bs, &s); err != nil {
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	// an empty file is an empty schedule, which check rejects
+	if err = dec.Decode(&s); err != nil && err != io.EOF {
 		return Schedule{}, err
 	}
+	if s, err = s.promotePrimary(); err != nil {
+		return Schedule{}, err
+	}
+	if s.RosterFile != "" {
+		if s.Roster, err = s.readRoster(f); err != nil {
+			return Schedule{}, err
+		}
+		s = s.mapUsers(s.Roster.Email)
+	}
 	if err = check(s); err != nil {
 		return Schedule{}, err
 	}
@@ -106,21 +289,426 @@ func Read(f string) (s Schedule, err error) {
 // a custom marshaller is used so we can translate a list into a map with ordered keys.
 func (sl ShiftList) MarshalYAML() (interface{}, error) {
 	if len(sl) < 1 {
-		return nil, errors.New("cannot marshal an empty shift list")
+		return &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}, nil
 	}
-	m := yaml.MapSlice{}
-	for _, s := range sl {
-		m = append(m, yaml.MapItem{Key: s.Start, Value: s.Email})
+	m := &yaml.Node{Kind: yaml.MappingNode}
+	for i, s := range sl {
+		v := scalar(s.Email)
+		if s.hasMeta() {
+			v = &yaml.Node{}
+			if err := v.Encode(mapShift{s.Email, s.Note, s.Ticket, s.SwappedFrom}); err != nil {
+				return nil, err
+			}
+			v.Style = yaml.FlowStyle
+		}
+		m.Content = append(m.Content, shiftKey(s.Start), v)
+		if i < len(sl)-1 && s.End.Before(sl[i+1].Start) {
+			m.Content = append(m.Content, shiftKey(s.End), scalar(_shiftListGap))
+		}
 	}
-	m = append(m, yaml.MapItem{Key: sl[len(sl)-1].End, Value: _shiftListEnder})
+	m.Content = append(m.Content, shiftKey(sl[len(sl)-1].End), scalar(_shiftListEnder))
 	return m, nil
 }
 
+// listNode serializes a ShiftList in the explicit-interval list syntax.
+// items are written in block style, since yaml.v3 quotes timestamps within flow style collections.
+func (sl ShiftList) listNode() (*yaml.Node, error) {
+	n := &yaml.Node{Kind: yaml.SequenceNode}
+	if len(sl) < 1 {
+		n.Style = yaml.FlowStyle
+	}
+	for _, s := range sl {
+		item := &yaml.Node{}
+		if err := item.Encode(listShift(s)); err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, item)
+	}
+	return n, nil
+}
+
+func (s Shift) hasMeta() bool {
+	return s.Note != "" || s.Ticket != "" || s.SwappedFrom != ""
+}
+
+// _swappedFromSep separates the users a shift was swapped from, once shifts swapped from different users are joined
+const _swappedFromSep = ", "
+
+// joinMeta returns s with the metadata of o added to its own, for joining the two into one shift.
+// where they differ, both are kept.
+func (s Shift) joinMeta(o Shift) Shift {
+	s.Note = joinField(s.Note, o.Note, "; ")
+	s.Ticket = joinField(s.Ticket, o.Ticket, ", ")
+	s.SwappedFrom = joinField(s.SwappedFrom, o.SwappedFrom, _swappedFromSep)
+	return s
+}
+
+func joinField(a, b, sep string) string {
+	if b == "" || contains(strings.Split(a, sep), b) {
+		return a
+	}
+	if a == "" {
+		return b
+	}
+	return a + sep + b
+}
+
+// Annotation describes the metadata of the shift, or returns "" if it has none
+func (s Shift) Annotation() string {
+	parts := []string{}
+	if s.Note != "" {
+		parts = append(parts, s.Note)
+	}
+	if s.Ticket != "" {
+		parts = append(parts, "ticket "+s.Ticket)
+	}
+	if s.SwappedFrom != "" {
+		parts = append(parts, "swapped from "+s.SwappedFrom)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func shiftKey(t time.Time) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: t.Format(_timeFmt)}
+}
+
+func scalar(v string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+}
+
 // Write serializes a schedule into the given path
+// if the path already holds a schedule, its comments, key order and blank lines are kept for every entry
+// that is still present, so that tools rewriting a file don't lose the annotations people leave in it.
 func Write(path string, s Schedule) error {
-	serialized, err := yaml.Marshal(s)
-	if err != nil {
+	if len(s.Shifts) < 1 && s.Rotation == nil {
+		return errors.New("cannot marshal an empty shift list")
+	}
+	// users are written by their handles, but those the file already holds in another form are left as they are
+	canon := func(v string) string { return v }
+	if s.Roster != nil {
+		s = s.mapUsers(s.Roster.Handle)
+		canon = s.Roster.Email
+	}
+	s = s.demotePrimary()
+	n := &yaml.Node{}
+	if err := n.Encode(s); err != nil {
+		return err
+	}
+	if s.primaryLayer {
+		deleteKeys(n, "id", "shifts")
+	}
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{n}}
+	indent := _indent
+	if old, oldIndent, ok := readNode(path); ok {
+		if err := keepListForm(old.Content[0], n, s); err != nil {
+			return err
+		}
+		merge(old.Content[0], n, canon)
+		doc, indent = old, oldIndent
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, serialized, 0644)
+	return ioutil.WriteFile(path, restoreLines(buf.Bytes()), 0644)
+}
+
+// readNode parses the yaml document at path, marking the comments and blank lines it contains.
+// ok is false if there is no usable document to preserve.
+func readNode(path string) (doc *yaml.Node, indent int, ok bool) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	doc = &yaml.Node{}
+	if err := yaml.Unmarshal(bs, doc); err != nil {
+		return nil, 0, false
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, 0, false
+	}
+	lines := strings.Split(string(bs), "\n")
+	markLines(doc, lines)
+	return doc, indentOf(lines), true
+}
+
+// indentOf returns the smallest indent of the given lines, leaving out blank lines and comments, or _indent if none are indented
+func indentOf(lines []string) int {
+	indent := 0
+	for _, l := range lines {
+		trimmed := strings.TrimLeft(l, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(l) - len(trimmed); n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 {
+		return _indent
+	}
+	return indent
+}
+
+// keepListForm re-encodes each shift list of s in the explicit-interval list syntax if the old document used it.
+func keepListForm(old, n *yaml.Node, s Schedule) error {
+	lists := map[*ShiftList][]string{&s.Shifts: {"shifts"}}
+	for _, name := range s.LayerNames() {
+		l := s.Layers[name]
+		lists[&l.Shifts] = []string{"layers", name, "shifts"}
+	}
+	for sl, path := range lists {
+		if o := lookup(old, path...); o == nil || o.Kind != yaml.SequenceNode || len(o.Content) == 0 {
+			continue
+		}
+		v := lookup(n, path...)
+		if v == nil {
+			continue
+		}
+		ln, err := sl.listNode()
+		if err != nil {
+			return err
+		}
+		*v = *ln
+	}
+	return nil
+}
+
+// lookup returns the node found by following the given keys through nested maps, or nil if there is none.
+func lookup(n *yaml.Node, keys ...string) *yaml.Node {
+	for _, k := range keys {
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i < len(n.Content); i += 2 {
+			if n.Content[i].Value == k {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+// markLines records the comments and blank lines preceding each entry of doc as marker comments on that entry,
+// each holding its line as written. yaml splits such lines between head and foot comments, re-indents them
+// and adds blank lines of its own, so they are taken from lines instead and put back verbatim by restoreLines.
+func markLines(doc *yaml.Node, lines []string) {
+	claimed := map[int]bool{}
+	var walk func(n *yaml.Node, entry bool)
+	walk = func(n *yaml.Node, entry bool) {
+		n.HeadComment, n.FootComment = "", ""
+		// the lines before a block map item are recorded on the item, rather than on its first key on the same line
+		if entry && n.Line > 0 && !claimed[n.Line] {
+			claimed[n.Line] = true
+			n.HeadComment = markGap(lines, n.Line)
+		}
+		if n.Style&yaml.FlowStyle != 0 {
+			return
+		}
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, false)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				walk(n.Content[i], true)
+				walk(n.Content[i+1], false)
+			}
+		case yaml.SequenceNode:
+			for _, c := range n.Content {
+				walk(c, true)
+			}
+		}
+	}
+	walk(doc, false)
+
+	// the lines after the last entry, save the one left by the final newline, are kept at the foot of the document
+	end := len(lines)
+	if end > 0 && lines[end-1] == "" {
+		end--
+	}
+	doc.FootComment = markGap(lines, end+1)
+}
+
+// markGap returns the comments and blank lines directly above the given 1-based line as marker comments
+func markGap(lines []string, line int) string {
+	end := line - 1
+	if end > len(lines) {
+		end = len(lines)
+	}
+	start := end
+	for start > 0 && isGapLine(lines[start-1]) {
+		start--
+	}
+	marked := make([]string, 0, end-start)
+	for _, l := range lines[start:end] {
+		marked = append(marked, _lineMarker+l)
+	}
+	return strings.Join(marked, "\n")
+}
+
+func isGapLine(l string) bool {
+	l = strings.TrimSpace(l)
+	return l == "" || strings.HasPrefix(l, "#")
+}
+
+func joinComments(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "\n" + b
+}
+
+// restoreLines puts back the lines recorded by markLines, as they were written.
+// a blank line the encoder adds before them, as it does before the foot of the document, is dropped.
+func restoreLines(bs []byte) []byte {
+	lines := strings.Split(string(bs), "\n")
+	res := make([]string, 0, len(lines))
+	for i, l := range lines {
+		trimmed := strings.TrimLeft(l, " ")
+		switch {
+		case strings.HasPrefix(trimmed, _lineMarker):
+			res = append(res, strings.TrimPrefix(trimmed, _lineMarker))
+		case trimmed == "" && i+1 < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i+1], " "), _lineMarker):
+		default:
+			res = append(res, l)
+		}
+	}
+	return []byte(strings.Join(res, "\n"))
+}
+
+// merge updates dst in place to hold the contents of src,
+// keeping the comments and layout of every part of dst that has an equivalent in src.
+func merge(dst, src *yaml.Node, canon func(string) string) {
+	if dst.Kind != src.Kind {
+		replace(dst, src)
+		return
+	}
+	switch dst.Kind {
+	case yaml.ScalarNode:
+		if !scalarEqual(dst, src, canon) {
+			replace(dst, src)
+		}
+	case yaml.MappingNode:
+		mergeMapping(dst, src, canon)
+	case yaml.SequenceNode:
+		mergeSequence(dst, src, canon)
+	default:
+		replace(dst, src)
+	}
+}
+
+// replace overwrites dst with src, keeping only the comments of dst.
+func replace(dst, src *yaml.Node) {
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *src
+	dst.HeadComment = joinComments(head, src.HeadComment)
+	if line != "" {
+		dst.LineComment = line
+	}
+	dst.FootComment = joinComments(foot, src.FootComment)
+}
+
+// mergeMapping keeps the entries of dst that are still present in src, in their existing order.
+// entries new to src are placed after the entry preceding them in src.
+func mergeMapping(dst, src *yaml.Node, canon func(string) string) {
+	matched := map[int]int{}
+	for j := 0; j < len(src.Content); j += 2 {
+		for i := 0; i < len(dst.Content); i += 2 {
+			if _, ok := matched[i]; !ok && scalarEqual(dst.Content[i], src.Content[j], canon) {
+				matched[i] = j
+				break
+			}
+		}
+	}
+	srcMatched := map[int]bool{}
+	for _, j := range matched {
+		srcMatched[j] = true
+	}
+
+	// followers holds the unmatched entries of src, keyed by the src index of the matched entry preceding them
+	followers := map[int][]*yaml.Node{}
+	prev := -1
+	for j := 0; j < len(src.Content); j += 2 {
+		if srcMatched[j] {
+			prev = j
+			continue
+		}
+		followers[prev] = append(followers[prev], src.Content[j], src.Content[j+1])
+	}
+
+	content := followers[-1]
+	for i := 0; i < len(dst.Content); i += 2 {
+		j, ok := matched[i]
+		if !ok {
+			continue
+		}
+		merge(dst.Content[i+1], src.Content[j+1], canon)
+		content = append(content, dst.Content[i], dst.Content[i+1])
+		content = append(content, followers[j]...)
+	}
+	dst.Content = content
+}
+
+// mergeSequence keeps the order of src, reusing the items of dst that are equal to an item of src.
+// items that are maps, such as shifts in the list syntax, are matched by their `start`.
+func mergeSequence(dst, src *yaml.Node, canon func(string) string) {
+	used := map[int]bool{}
+	content := make([]*yaml.Node, 0, len(src.Content))
+	for _, s := range src.Content {
+		found := false
+		for i, d := range dst.Content {
+			if used[i] {
+				continue
+			}
+			if d.Kind == yaml.ScalarNode && scalarEqual(d, s, canon) {
+				used[i] = true
+				content = append(content, d)
+				found = true
+				break
+			}
+			if ds, ss := lookup(d, "start"), lookup(s, "start"); d.Kind == yaml.MappingNode && ds != nil && ss != nil && scalarEqual(ds, ss, canon) {
+				merge(d, s, canon)
+				used[i] = true
+				content = append(content, d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			content = append(content, s)
+		}
+	}
+	dst.Content = content
+}
+
+// scalarEqual reports whether two scalars hold the same value, once canon maps each to the value it stands for.
+// timestamps are equal if they denote the same instant, even if written with different offsets.
+func scalarEqual(a, b *yaml.Node, canon func(string) string) bool {
+	if a.Kind != yaml.ScalarNode || b.Kind != yaml.ScalarNode {
+		return false
+	}
+	if a.Value == b.Value || canon(a.Value) == canon(b.Value) {
+		return true
+	}
+	ta, errA := time.Parse(_timeFmt, a.Value)
+	tb, errB := time.Parse(_timeFmt, b.Value)
+	return errA == nil && errB == nil && ta.Equal(tb)
 }
@@ -1,16 +1,16 @@
 package stickyshift
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	yaml "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 func TestRead(t *testing.T) {
@@ -36,6 +36,51 @@ shifts: []
 			},
 			wantErr: "",
 		},
+		{
+			msg: "layers",
+			in: `
+id: _
+shifts: []
+layers:
+  secondary:
+    id: __
+    shifts:
+      1970-01-01T00:00:00Z: a
+      1970-01-02T00:00:00Z: TBD
+`,
+			want: Schedule{
+				Id: "_",
+				Layers: map[string]Layer{
+					"secondary": {
+						Id: "__",
+						Shifts: ShiftList{{
+							Email: "a",
+							Start: mustTime(t, "1970-01-01T00:00:00Z"),
+							End:   mustTime(t, "1970-01-02T00:00:00Z"),
+						}},
+					},
+				},
+			},
+		},
+		{
+			msg: "rotation",
+			in: `
+id: _
+shifts: []
+rotation:
+  anchor: 1970-01-01T00:00:00Z
+  length: 168h
+  users: [a, b]
+`,
+			want: Schedule{
+				Id: "_",
+				Rotation: &Rotation{
+					Anchor: mustTime(t, "1970-01-01T00:00:00Z"),
+					Length: 168 * time.Hour,
+					Users:  []string{"a", "b"},
+				},
+			},
+		},
 		{
 			msg: "bad yaml",
 			in: `
@@ -48,6 +93,11 @@ _: _
 			in:      `{}`,
 			wantErr: "schedule is missing `id`",
 		},
+		{
+			msg:     "empty file",
+			in:      ``,
+			wantErr: "schedule is missing `id`",
+		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
 			f := tmp(t, test.in)
@@ -67,13 +117,12 @@ _: _
 
 func TestUnmarshalShifts(t *testing.T) {
 	sl := &ShiftList{}
-	assert.Error(t, sl.UnmarshalYAML(func(interface{}) error {
-		return errors.New("_")
-	}))
+	assert.Error(t, sl.UnmarshalYAML(&yaml.Node{Kind: yaml.ScalarNode}))
 
 	t0 := time.Time{}
 	t1 := t0.Add(time.Second)
 	t2 := t1.Add(time.Second)
+	t3 := t2.Add(time.Second)
 
 	for _, test := range []struct {
 		msg     string
@@ -102,6 +151,126 @@ func TestUnmarshalShifts(t *testing.T) {
 			},
 			wantErr: "",
 		},
+		{
+			msg: "gap",
+			in: fmt.Sprintf(`
+%v: a
+%v: %s
+%v: b
+%v: %s
+`, t0.Format(_timeFmt), t1.Format(_timeFmt), _shiftListGap, t2.Format(_timeFmt), t3.Format(_timeFmt), _shiftListEnder),
+			want: ShiftList{
+				{
+					Start: t0,
+					End:   t1,
+					Email: "a",
+				},
+				{
+					Start: t2,
+					End:   t3,
+					Email: "b",
+				},
+			},
+		},
+		{
+			msg: "list",
+			in: fmt.Sprintf(`
+- {email: a, start: %v, end: %v, note: swapped with b}
+- email: b
+  start: %v
+  end: %v
+`, t1.Format(_timeFmt), t2.Format(_timeFmt), t2.Format(_timeFmt), t3.Format(_timeFmt)),
+			want: ShiftList{
+				{
+					Start: t1,
+					End:   t2,
+					Email: "a",
+					Note:  "swapped with b",
+				},
+				{
+					Start: t2,
+					End:   t3,
+					Email: "b",
+				},
+			},
+		},
+		{
+			msg: "metadata",
+			in: fmt.Sprintf(`
+%v: {email: a, note: covering, ticket: OPS-1, swappedFrom: b}
+%v: b
+%v: %v
+`, t0.Format(_timeFmt), t1.Format(_timeFmt), t2.Format(_timeFmt), _shiftListEnder),
+			want: ShiftList{
+				{
+					Start:       t0,
+					End:         t1,
+					Email:       "a",
+					Note:        "covering",
+					Ticket:      "OPS-1",
+					SwappedFrom: "b",
+				},
+				{
+					Start: t1,
+					End:   t2,
+					Email: "b",
+				},
+			},
+		},
+		{
+			msg: "metadata unknown field",
+			in: fmt.Sprintf(`
+%v: {email: a, _: _}
+%v: %v
+`, t0.Format(_timeFmt), t1.Format(_timeFmt), _shiftListEnder),
+			wantErr: "field _ not found in shift",
+		},
+		{
+			msg: "metadata missing email",
+			in: fmt.Sprintf(`
+%v: {note: _}
+%v: %v
+`, t0.Format(_timeFmt), t1.Format(_timeFmt), _shiftListEnder),
+			wantErr: "missing `email` field",
+		},
+		{
+			msg: "metadata on shift list ending",
+			in: fmt.Sprintf(`
+%v: a
+%v: {email: %v}
+`, t0.Format(_timeFmt), t1.Format(_timeFmt), _shiftListEnder),
+			wantErr: "shift email is not a yaml string",
+		},
+		{
+			msg:     "list item not a map",
+			in:      `[_]`,
+			wantErr: "shift is not a yaml map",
+		},
+		{
+			msg:     "list item unknown field",
+			in:      `[{_: _}]`,
+			wantErr: "field _ not found in shift",
+		},
+		{
+			msg:     "list item bad timestamp",
+			in:      `[{email: a, start: _}]`,
+			wantErr: "cannot parse",
+		},
+		{
+			msg:     "list item missing email",
+			in:      fmt.Sprintf(`[{start: %v, end: %v}]`, t1.Format(_timeFmt), t2.Format(_timeFmt)),
+			wantErr: "missing `email` field",
+		},
+		{
+			msg:     "list item missing end",
+			in:      fmt.Sprintf(`[{email: a, start: %v}]`, t1.Format(_timeFmt)),
+			wantErr: "both `start` and `end`",
+		},
+		{
+			msg:     "list item backwards",
+			in:      fmt.Sprintf(`[{email: a, start: %v, end: %v}]`, t2.Format(_timeFmt), t1.Format(_timeFmt)),
+			wantErr: "must start before it ends",
+		},
 		{
 			msg: "no shift list ending",
 			in: fmt.Sprintf(`
@@ -114,9 +283,14 @@ func TestUnmarshalShifts(t *testing.T) {
 			in:      `{{{{{`,
 			wantErr: "did not find expected node",
 		},
+		{
+			msg:     "not a map or list",
+			in:      `_`,
+			wantErr: "shifts must be a yaml map or list",
+		},
 		{
 			msg:     "bad key",
-			in:      `- _: _`,
+			in:      `[_]: _`,
 			wantErr: "shift time is not a yaml string",
 		},
 		{
@@ -160,6 +334,78 @@ func TestWrite(t *testing.T) {
 			sched:   Schedule{},
 			wantErr: "cannot marshal an empty shift list",
 		},
+		{
+			msg: "rotation only",
+			sched: Schedule{
+				Id: "xxx",
+				Rotation: &Rotation{
+					Anchor: mustTime(t, "1970-01-01T00:00:00-07:00"),
+					Length: 24 * time.Hour,
+					Users:  []string{"foo", "bar"},
+				},
+			},
+			want: `id: xxx
+shifts: []
+rotation:
+  anchor: 1970-01-01T00:00:00-07:00
+  length: 24h0m0s
+  users:
+    - foo
+    - bar
+`,
+		},
+		{
+			msg: "gap",
+			sched: Schedule{
+				Id: "xxx",
+				Shifts: ShiftList{
+					{
+						Start: mustTime(t, "1970-01-01T00:00:00-07:00"),
+						End:   mustTime(t, "1970-01-02T00:00:00-07:00"),
+						Email: "foo",
+					},
+					{
+						Start: mustTime(t, "1970-01-03T00:00:00-07:00"),
+						End:   mustTime(t, "1970-01-04T00:00:00-07:00"),
+						Email: "foo",
+					},
+				},
+			},
+			want: `id: xxx
+shifts:
+  1970-01-01T00:00:00-07:00: foo
+  1970-01-02T00:00:00-07:00: ROTATION
+  1970-01-03T00:00:00-07:00: foo
+  1970-01-04T00:00:00-07:00: TBD
+`,
+		},
+		{
+			msg: "metadata",
+			sched: Schedule{
+				Id: "xxx",
+				Shifts: ShiftList{
+					{
+						Start: mustTime(t, "1970-01-01T00:00:00-07:00"),
+						End:   mustTime(t, "1970-01-02T00:00:00-07:00"),
+						Email: "foo",
+					},
+					{
+						Start:       mustTime(t, "1970-01-02T00:00:00-07:00"),
+						End:         mustTime(t, "1970-01-03T00:00:00-07:00"),
+						Email:       "bar",
+						Note:        "foo is at a wedding",
+						Ticket:      "https://example.com/OPS-1",
+						SwappedFrom: "foo",
+					},
+				},
+			},
+			want: `id: xxx
+shifts:
+  1970-01-01T00:00:00-07:00: foo
+  1970-01-02T00:00:00-07:00: {email: bar, note: foo is at a wedding, ticket: 'https://example.com/OPS-1', swappedFrom: foo}
+  1970-01-03T00:00:00-07:00: TBD
+`,
+		},
 		{
 			msg: "ok",
 			sched: Schedule{
@@ -205,6 +451,247 @@ shifts:
 	}
 }
 
+func TestWritePreservesLayout(t *testing.T) {
+	in := `# oncall for the foo team
+id: foo # do not change
+
+shifts:
+  # swapped with bob for conference
+  1970-01-01T00:00:00-07:00: foo
+  1970-01-02T00:00:00-07:00: bar # trailing
+
+  1970-01-03T00:00:00-07:00: TBD
+`
+	f := tmp(t, in)
+	defer os.Remove(f)
+
+	s, err := Read(f)
+	require.NoError(t, err)
+	require.NoError(t, Write(f, s))
+	bs, err := ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, in, string(bs), "unchanged schedule should round trip exactly")
+
+	s.Shifts[1].End = mustTime(t, "1970-01-04T00:00:00-07:00")
+	s.Shifts = append(s.Shifts, Shift{
+		Email: "baz",
+		Start: mustTime(t, "1970-01-04T00:00:00-07:00"),
+		End:   mustTime(t, "1970-01-05T00:00:00-07:00"),
+	})
+	require.NoError(t, Write(f, s))
+	bs, err = ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, `# oncall for the foo team
+id: foo # do not change
+
+shifts:
+  # swapped with bob for conference
+  1970-01-01T00:00:00-07:00: foo
+  1970-01-02T00:00:00-07:00: bar # trailing
+  1970-01-04T00:00:00-07:00: baz
+  1970-01-05T00:00:00-07:00: TBD
+`, string(bs))
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for name, in := range map[string]string{
+		"comment above the document": `# top
+
+id: foo
+shifts:
+  1970-01-01T00:00:00Z: a
+  1970-01-02T00:00:00Z: TBD
+`,
+		"comment apart from its key": `id: foo
+shifts:
+  1970-01-01T00:00:00Z: a
+  # note about b
+
+  1970-01-02T00:00:00Z: b
+  1970-01-03T00:00:00Z: TBD
+`,
+		"comment apart from its key after a blank line": `id: foo
+shifts:
+  1970-01-01T00:00:00Z: a
+
+  # note about b
+
+  1970-01-02T00:00:00Z: b
+  1970-01-03T00:00:00Z: TBD
+`,
+		"comment apart from a list item": `id: foo
+shifts:
+  - email: a
+    start: 1970-01-01T00:00:00Z
+    end: 1970-01-02T00:00:00Z
+  # note about b
+
+  - email: b
+    start: 1970-01-02T00:00:00Z
+    end: 1970-01-03T00:00:00Z
+`,
+		"blank lines around a top-level comment": `id: foo
+
+# the shifts
+
+shifts:
+  1970-01-01T00:00:00Z: a
+  1970-01-02T00:00:00Z: TBD
+`,
+		"comments at the end of a block and of the file": `id: foo
+extend:
+  minDays: 14
+  maxDays: 28
+  users: [a, b]
+  # more to come
+
+
+shifts:
+  1970-01-01T00:00:00Z: a # first
+  1970-01-02T00:00:00Z: TBD
+
+# the end
+`,
+		"comments between list items": `id: foo
+extend:
+  minDays: 14
+  maxDays: 28
+  users:
+    # leads
+    - a
+
+    - b
+shifts:
+  - email: a
+    start: 1970-01-01T00:00:00Z
+    end: 1970-01-02T00:00:00Z
+
+  # note about b
+  - email: b
+    start: 1970-01-02T00:00:00Z
+    end: 1970-01-03T00:00:00Z
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := tmp(t, in)
+			defer os.Remove(f)
+
+			s, err := Read(f)
+			require.NoError(t, err)
+			require.NoError(t, Write(f, s))
+			bs, err := ioutil.ReadFile(f)
+			require.NoError(t, err)
+			assert.Equal(t, in, string(bs), "unchanged schedule should round trip exactly")
+		})
+	}
+}
+
+func TestPrimaryLayer(t *testing.T) {
+	in := `layers:
+  primary:
+    id: foo
+    shifts:
+      1970-01-01T00:00:00Z: a
+      1970-01-02T00:00:00Z: TBD
+  secondary:
+    id: bar
+    shifts:
+      1970-01-01T00:00:00Z: b
+      1970-01-02T00:00:00Z: TBD
+`
+	f := tmp(t, in)
+	defer os.Remove(f)
+
+	s, err := Read(f)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", s.Id, "layers.primary should be the schedule's own shifts")
+	assert.Equal(t, ShiftList{{Email: "a", Start: mustTime(t, "1970-01-01T00:00:00Z"), End: mustTime(t, "1970-01-02T00:00:00Z")}}, s.Shifts)
+	assert.Equal(t, []string{"secondary"}, s.LayerNames())
+
+	s.Shifts[0].Email = "c"
+	require.NoError(t, Write(f, s))
+	bs, err := ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Replace(in, "00Z: a", "00Z: c", 1), string(bs), "the primary shifts should be written back to their layer")
+
+	f2 := tmp(t, "id: foo\nshifts: {1970-01-01T00:00:00Z: TBD}\n"+in)
+	defer os.Remove(f2)
+	_, err = Read(f2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot both be given")
+}
+
+func TestWritePreservesIndent(t *testing.T) {
+	in := `id: foo
+extend:
+    minDays: 14
+    maxDays: 28
+    users: [foo, bar]
+shifts:
+    1970-01-01T00:00:00-07:00: foo
+    1970-01-02T00:00:00-07:00: TBD
+`
+	f := tmp(t, in)
+	defer os.Remove(f)
+
+	s, err := Read(f)
+	require.NoError(t, err)
+	s.Shifts[0].Email = "bar"
+	require.NoError(t, Write(f, s))
+	bs, err := ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Replace(in, "00-07:00: foo", "00-07:00: bar", 1), string(bs), "the file's own indent should be kept")
+}
+
+func TestWritePreservesListForm(t *testing.T) {
+	in := `id: foo
+shifts:
+  # swapped with bob for conference
+  - email: foo
+    start: 1970-01-01T00:00:00-07:00
+    end: 1970-01-02T00:00:00-07:00
+    note: conference
+
+  - email: bar
+    start: 1970-01-03T00:00:00-07:00
+    end: 1970-01-04T00:00:00-07:00
+`
+	f := tmp(t, in)
+	defer os.Remove(f)
+
+	s, err := Read(f)
+	require.NoError(t, err)
+	require.NoError(t, Write(f, s))
+	bs, err := ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, in, string(bs), "unchanged schedule should round trip exactly")
+
+	s.Shifts[1].Email = "baz"
+	s.Shifts = append(s.Shifts, Shift{
+		Email: "bar",
+		Start: mustTime(t, "1970-01-04T00:00:00-07:00"),
+		End:   mustTime(t, "1970-01-05T00:00:00-07:00"),
+	})
+	require.NoError(t, Write(f, s))
+	bs, err = ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, `id: foo
+shifts:
+  # swapped with bob for conference
+  - email: foo
+    start: 1970-01-01T00:00:00-07:00
+    end: 1970-01-02T00:00:00-07:00
+    note: conference
+
+  - email: baz
+    start: 1970-01-03T00:00:00-07:00
+    end: 1970-01-04T00:00:00-07:00
+  - email: bar
+    start: 1970-01-04T00:00:00-07:00
+    end: 1970-01-05T00:00:00-07:00
+`, string(bs))
+}
+
 func mustTime(t *testing.T, ts string) time.Time {
 	res, err := time.Parse(time.RFC3339, ts)
 	require.NoError(t, err)
@@ -0,0 +1,138 @@
+package stickyshift
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reassignment records a shift that was handed from one user to another
+type Reassignment struct {
+	Shift
+	To string
+	// Layer is the name of the layer the shift is in, or "" for the schedule's own shifts
+	Layer string
+}
+
+// Offboard removes email from the schedule from time now on.
+// email is dropped from the users the schedule is extended with and from the pools of its rotation, and each of their
+// shifts after now, in the schedule's own shifts and in each of its layers, is handed to the fairest remaining user
+// who is not on call elsewhere in the schedule at the time, weighing their preferences. a shift in progress at now is
+// split, so that only its remainder is reassigned.
+func Offboard(s Schedule, email string, now time.Time, prefs Preferences) (Schedule, []Reassignment, error) {
+	if s.Extend != nil {
+		ext := s.Extend.clone()
+		ext.Users = without(ext.Users, email)
+		delete(ext.StartAfter, email)
+		s.Extend = ext
+	}
+	if s.Rotation != nil {
+		r := s.Rotation.clone()
+		if contains(r.Users, email) {
+			r.Users = without(r.Users, email)
+		}
+		for i := range r.Segments {
+			r.Segments[i].Users = without(r.Segments[i].Users, email)
+		}
+		s.Rotation = r
+	}
+
+	sl, res, ok := reassign(s.Shifts, email, now, s.pool, s.busyBesides(""), prefs, "")
+	if !ok {
+		return Schedule{}, nil, fmt.Errorf("no users are left to take over %v's shifts in %v", email, s.Id)
+	}
+	s.Shifts = sl
+
+	if len(s.Layers) > 0 {
+		layers := map[string]Layer{}
+		for name, l := range s.Layers {
+			layers[name] = l
+		}
+		s.Layers = layers
+	}
+	for _, name := range s.LayerNames() {
+		l := s.Layers[name]
+		sl, moves, ok := reassign(l.Shifts, email, now, Schedule{Shifts: l.Shifts}.pool, s.busyBesides(name), prefs, name)
+		if !ok {
+			return Schedule{}, nil, fmt.Errorf("no users are left to take over %v's shifts in %v", email, l.Id)
+		}
+		l.Shifts = sl
+		s.Layers[name] = l
+		res = append(res, moves...)
+	}
+
+	if err := check(s); err != nil {
+		return Schedule{}, nil, err
+	}
+	return s, res, nil
+}
+
+// reassign hands each shift of email in sl from now on to the fairest of the users pool gives for its start, leaving
+// out those on call in busy at the time. ok is false if a shift is left without anyone to take it.
+func reassign(sl ShiftList, email string, now time.Time, pool func(time.Time) []string, busy ShiftList, prefs Preferences, layer string) (res ShiftList, moves []Reassignment, ok bool) {
+	sl = sl.clone().split(now)
+	moves = []Reassignment{}
+	for i := range sl {
+		if sl[i].Email != email || sl[i].Start.Before(now) {
+			continue
+		}
+		free := []string{}
+		for _, u := range without(pool(sl[i].Start), email) {
+			if !busy.overlaps(u, sl[i]) {
+				free = append(free, u)
+			}
+		}
+		to := sl.fairest(free, i, prefs)
+		if to == "" {
+			return nil, nil, false
+		}
+		moves = append(moves, Reassignment{sl[i], to, layer})
+		sl[i].Email = to
+	}
+	return sl.merge(), moves, true
+}
+
+// busyBesides returns the shifts of s outside of the given layer, or outside of its own shifts if layer is "".
+// the schedule's own shifts include those of its rotation.
+func (s Schedule) busyBesides(layer string) ShiftList {
+	res := ShiftList{}
+	for _, name := range s.LayerNames() {
+		if name == layer {
+			continue
+		}
+		res = append(res, s.Layers[name].Shifts...)
+	}
+	if l, ok := s.Layers[layer]; ok && len(l.Shifts) > 0 {
+		res = append(res, s.Expand(l.Shifts[0].Start, l.Shifts[len(l.Shifts)-1].End)...)
+	}
+	return res
+}
+
+// overlaps reports whether u has a shift in sl that overlaps s
+func (sl ShiftList) overlaps(u string, s Shift) bool {
+	for _, o := range sl {
+		if o.Email == u && o.Start.Before(s.End) && s.Start.Before(o.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rotation) clone() *Rotation {
+	res := *r
+	res.Users = append([]string(nil), r.Users...)
+	res.Segments = append([]Segment(nil), r.Segments...)
+	for i, seg := range res.Segments {
+		res.Segments[i].Users = append([]string(nil), seg.Users...)
+	}
+	return &res
+}
+
+func without(ss []string, s string) []string {
+	res := []string{}
+	for _, x := range ss {
+		if x != s {
+			res = append(res, x)
+		}
+	}
+	return res
+}
@@ -0,0 +1,168 @@
+package stickyshift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffboard(t *testing.T) {
+	for _, test := range []struct {
+		msg       string
+		in        Schedule
+		now       time.Time
+		prefs     Preferences
+		want      Schedule
+		wantMoves []Reassignment
+		wantErr   string
+	}{
+		{
+			msg:       "not in schedule",
+			in:        Schedule{Id: "_", Shifts: shifts("a", "b")},
+			now:       day(1),
+			want:      Schedule{Id: "_", Shifts: shifts("a", "b")},
+			wantMoves: []Reassignment{},
+		},
+		{
+			msg: "past shifts are kept",
+			in:  Schedule{Id: "_", Shifts: shifts("x", "a", "x", "b")},
+			now: day(3),
+			want: Schedule{Id: "_", Shifts: ShiftList{
+				{Email: "x", Start: day(1), End: day(2)},
+				{Email: "a", Start: day(2), End: day(4)},
+				{Email: "b", Start: day(4), End: day(5)},
+			}},
+			wantMoves: []Reassignment{{Shift{Email: "x", Start: day(3), End: day(4)}, "a", ""}},
+		},
+		{
+			msg: "shift in progress is split",
+			in:  Schedule{Id: "_", Shifts: shifts("a", "x", "b")},
+			now: day(2).Add(time.Hour),
+			want: Schedule{Id: "_", Shifts: ShiftList{
+				{Email: "a", Start: day(1), End: day(2)},
+				{Email: "x", Start: day(2), End: day(2).Add(time.Hour)},
+				{Email: "a", Start: day(2).Add(time.Hour), End: day(3)},
+				{Email: "b", Start: day(3), End: day(4)},
+			}},
+			wantMoves: []Reassignment{{Shift{Email: "x", Start: day(2).Add(time.Hour), End: day(3)}, "a", ""}},
+		},
+		{
+			msg: "removed from extend users, least loaded takes over",
+			in: Schedule{
+				Id:     "_",
+				Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b", "x", "c"}},
+				Shifts: shifts("a", "b", "a", "x"),
+			},
+			now: day(1),
+			want: Schedule{
+				Id:     "_",
+				Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b", "c"}},
+				Shifts: shifts("a", "b", "a", "c"),
+			},
+			wantMoves: []Reassignment{{Shift{Email: "x", Start: day(4), End: day(5)}, "c", ""}},
+		},
+		{
+			msg: "preferences are weighed",
+			in: Schedule{
+				Id:     "_",
+				Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b", "x", "c"}},
+				Shifts: shifts("a", "b", "a", "x"),
+			},
+			now:   day(1),
+			prefs: Preferences{"c": {Avoid: []Window{{Start: day(4), End: day(5)}}}},
+			want: Schedule{
+				Id:     "_",
+				Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "b", "c"}},
+				Shifts: ShiftList{
+					{Email: "a", Start: day(1), End: day(2)},
+					{Email: "b", Start: day(2), End: day(3)},
+					{Email: "a", Start: day(3), End: day(4)},
+					{Email: "b", Start: day(4), End: day(5)},
+				},
+			},
+			wantMoves: []Reassignment{{Shift{Email: "x", Start: day(4), End: day(5)}, "b", ""}},
+		},
+		{
+			msg: "removed from the rotation, layer shifts reassigned",
+			in: Schedule{
+				Id:       "_",
+				Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Users: []string{"a", "x", "b"}},
+				Shifts:   ShiftList{{Email: "x", Start: day(3), End: day(4)}},
+				Layers:   map[string]Layer{"secondary": {Id: "s", Shifts: shifts("b", "x", "c", "d")}},
+			},
+			now: day(1),
+			want: Schedule{
+				Id:       "_",
+				Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Users: []string{"a", "b"}},
+				Shifts:   ShiftList{{Email: "a", Start: day(3), End: day(4)}},
+				Layers: map[string]Layer{"secondary": {Id: "s", Shifts: ShiftList{
+					{Email: "b", Start: day(1), End: day(2)},
+					{Email: "d", Start: day(2), End: day(3)},
+					{Email: "c", Start: day(3), End: day(4)},
+					{Email: "d", Start: day(4), End: day(5)},
+				}}},
+			},
+			wantMoves: []Reassignment{
+				{Shift{Email: "x", Start: day(3), End: day(4)}, "a", ""},
+				// b is on call in the rotation then, and c right after it
+				{Shift{Email: "x", Start: day(2), End: day(3)}, "d", "secondary"},
+			},
+		},
+		{
+			msg: "removed from rotation segments",
+			in: Schedule{
+				Id: "_",
+				Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Segments: []Segment{
+					{Name: "weekdays", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Users: []string{"a", "x"}},
+					{Name: "weekends", Users: []string{"x", "b"}},
+				}},
+			},
+			now: day(1),
+			want: Schedule{
+				Id: "_",
+				Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Segments: []Segment{
+					{Name: "weekdays", Days: []string{"mon", "tue", "wed", "thu", "fri"}, Users: []string{"a"}},
+					{Name: "weekends", Users: []string{"b"}},
+				}},
+				Shifts: ShiftList{},
+			},
+			wantMoves: []Reassignment{},
+		},
+		{
+			msg:     "nobody left",
+			in:      Schedule{Id: "_", Shifts: shifts("x")},
+			now:     day(1),
+			wantErr: "no users are left",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			res, moves, err := Offboard(test.in, "x", test.now, test.prefs)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, res)
+			assert.Equal(t, test.wantMoves, moves)
+		})
+	}
+}
+
+func TestOffboardKeepsInput(t *testing.T) {
+	in := Schedule{
+		Id:       "_",
+		Extend:   &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "x"}},
+		Shifts:   shifts("a", "x"),
+		Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Segments: []Segment{{Name: "all", Users: []string{"a", "x"}}}},
+		Layers:   map[string]Layer{"secondary": {Id: "s", Shifts: shifts("x", "b")}},
+	}
+	_, _, err := Offboard(in, "x", day(1), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "x"}, in.Extend.Users)
+	assert.Equal(t, shifts("a", "x"), in.Shifts)
+	assert.Equal(t, []string{"a", "x"}, in.Rotation.Segments[0].Users)
+	assert.Equal(t, shifts("x", "b"), in.Layers["secondary"].Shifts)
+}
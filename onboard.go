@@ -0,0 +1,94 @@
+package stickyshift
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Onboard adds email to the users the schedule is extended with.
+// they are not given shifts that start before startAfter, which leaves them time to ramp up.
+func Onboard(s Schedule, email string, startAfter time.Time) (Schedule, error) {
+	if s.Extend == nil {
+		return Schedule{}, errors.New("schedule has no `extend` section to add users to")
+	}
+	if contains(s.Extend.Users, email) {
+		return Schedule{}, fmt.Errorf("%v is already in extend.users", email)
+	}
+
+	ext := s.Extend.clone()
+	ext.Users = append(ext.Users, email)
+	if !startAfter.IsZero() {
+		if ext.StartAfter == nil {
+			ext.StartAfter = map[string]time.Time{}
+		}
+		ext.StartAfter[email] = startAfter
+	}
+	s.Extend = ext
+
+	if err := check(s); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+// Shadow puts email on call in the given layer alongside the schedule's own shifts from `from` until `until`,
+// such as a new hire's ramp-up, so that they shadow whoever is on call. each stretch of shadowing notes whom it shadows.
+// the layer must already exist, since it needs its own pagerduty schedule id.
+func Shadow(s Schedule, layer, email string, from, until time.Time) (Schedule, error) {
+	l, ok := s.Layers[layer]
+	if !ok {
+		return Schedule{}, fmt.Errorf("schedule has no layer %v to shadow in; add it with its pagerduty schedule id", layer)
+	}
+	if !from.Before(until) {
+		return Schedule{}, fmt.Errorf("shadowing must start before it ends, but %v >= %v", from.Format(_timeFmt), until.Format(_timeFmt))
+	}
+
+	shadow := ShiftList{}
+	shadowed := []string{}
+	for _, p := range s.Expand(from, until) {
+		start, end := later(p.Start, from), earlier(p.End, until)
+		if !start.Before(end) {
+			continue
+		}
+		if n := len(shadow); n > 0 && shadow[n-1].End.Equal(start) {
+			shadow[n-1].End = end
+		} else {
+			shadow = append(shadow, Shift{Email: email, Start: start, End: end})
+			shadowed = []string{}
+		}
+		if !contains(shadowed, p.Email) {
+			shadowed = append(shadowed, p.Email)
+		}
+		shadow[len(shadow)-1].Note = "shadowing " + strings.Join(shadowed, ", ")
+	}
+	if len(shadow) < 1 {
+		return Schedule{}, fmt.Errorf("no shifts from %v to %v to shadow", from.Format(_timeFmt), until.Format(_timeFmt))
+	}
+
+	layers := map[string]Layer{}
+	for name, l := range s.Layers {
+		layers[name] = l
+	}
+	l.Shifts = l.Shifts.overlay(shadow)
+	layers[layer] = l
+	s.Layers = layers
+
+	if err := check(s); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+func (e *ExtendOpts) clone() *ExtendOpts {
+	res := *e
+	res.Users = append([]string{}, e.Users...)
+	if e.StartAfter != nil {
+		res.StartAfter = map[string]time.Time{}
+		for u, t := range e.StartAfter {
+			res.StartAfter[u] = t
+		}
+	}
+	return &res
+}
@@ -0,0 +1,126 @@
+package stickyshift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnboard(t *testing.T) {
+	ext := &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a"}}
+	for _, test := range []struct {
+		msg     string
+		in      Schedule
+		after   time.Time
+		want    *ExtendOpts
+		wantErr string
+	}{
+		{
+			msg:   "ok",
+			in:    Schedule{Id: "_", Extend: ext},
+			after: day(3),
+			want: &ExtendOpts{
+				MinDays:    14,
+				MaxDays:    28,
+				Users:      []string{"a", "x"},
+				StartAfter: map[string]time.Time{"x": day(3)},
+			},
+		},
+		{
+			msg:  "no ramp up",
+			in:   Schedule{Id: "_", Extend: ext},
+			want: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"a", "x"}},
+		},
+		{
+			msg:     "no extend section",
+			in:      Schedule{Id: "_"},
+			wantErr: "no `extend` section",
+		},
+		{
+			msg:     "already a user",
+			in:      Schedule{Id: "_", Extend: &ExtendOpts{MinDays: 14, MaxDays: 28, Users: []string{"x"}}},
+			wantErr: "already in extend.users",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			res, err := Onboard(test.in, "x", test.after)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, res.Extend)
+		})
+	}
+	assert.Equal(t, []string{"a"}, ext.Users, "input should not be modified")
+}
+
+func TestShadow(t *testing.T) {
+	s := Schedule{
+		Id: "_",
+		Shifts: ShiftList{
+			{Email: "a", Start: day(1), End: day(3)},
+			{Email: "b", Start: day(3), End: day(5)},
+			{Email: "a", Start: day(6), End: day(8)},
+		},
+		Layers: map[string]Layer{
+			"shadow":    {Id: "__", Shifts: ShiftList{{Email: "y", Start: day(0), End: day(1)}}},
+			"secondary": {Id: "___"},
+		},
+	}
+	for _, test := range []struct {
+		msg         string
+		layer       string
+		from, until time.Time
+		want        ShiftList
+		wantErr     string
+	}{
+		{
+			msg:   "ok",
+			layer: "shadow",
+			from:  day(2),
+			until: day(7),
+			want: ShiftList{
+				{Email: "y", Start: day(0), End: day(1)},
+				{Email: "x", Start: day(2), End: day(5), Note: "shadowing a, b"},
+				{Email: "x", Start: day(6), End: day(7), Note: "shadowing a"},
+			},
+		},
+		{
+			msg:     "no such layer",
+			layer:   "trainee",
+			from:    day(2),
+			until:   day(7),
+			wantErr: "no layer trainee",
+		},
+		{
+			msg:     "backwards",
+			layer:   "shadow",
+			from:    day(7),
+			until:   day(2),
+			wantErr: "must start before it ends",
+		},
+		{
+			msg:     "nothing to shadow",
+			layer:   "shadow",
+			from:    day(10),
+			until:   day(12),
+			wantErr: "no shifts",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			res, err := Shadow(s, test.layer, "x", test.from, test.until)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, res.Layers[test.layer].Shifts)
+		})
+	}
+	assert.Len(t, s.Layers["shadow"].Shifts, 1, "input should not be modified")
+}
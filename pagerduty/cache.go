@@ -0,0 +1,162 @@
+package pagerduty
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type (
+	// userCache holds the pagerduty ids of users by email, and is safe for concurrent use.
+	// if it has a file, it is shared through it with later runs against the same pagerduty account.
+	userCache struct {
+		sync.RWMutex
+		ids map[string]string
+		// resolved holds when each id was looked up, for those that are persisted
+		resolved map[string]time.Time
+		// stale holds the emails whose ids were read from the file, whose users may have changed since
+		stale   map[string]bool
+		file    string
+		account string
+	}
+
+	// cacheFile is the on-disk form of the user caches of every account
+	cacheFile struct {
+		Accounts map[string]map[string]cacheEntry `json:"accounts"`
+	}
+
+	cacheEntry struct {
+		Id       string    `json:"id"`
+		Resolved time.Time `json:"resolved"`
+	}
+)
+
+const (
+	_userCacheEnvVar = "PD_USER_CACHE"
+	// _userCacheTTL is how long a cached user id is trusted before it is looked up again
+	_userCacheTTL = 7 * 24 * time.Hour
+)
+
+func newUserCache(ids map[string]string) *userCache {
+	if ids == nil {
+		ids = map[string]string{}
+	}
+	return &userCache{ids: ids, resolved: map[string]time.Time{}, stale: map[string]bool{}}
+}
+
+// loadUserCache reads the ids of the given account's users from file, leaving out those older than the TTL.
+// a missing file is an empty cache, as is one that cannot be read, which is returned along with why.
+func loadUserCache(file, account string, now time.Time) (*userCache, error) {
+	u := newUserCache(nil)
+	u.file, u.account = file, account
+	cf, err := readCacheFile(file)
+	if err != nil {
+		return u, err
+	}
+	for email, e := range cf.Accounts[account] {
+		if now.Sub(e.Resolved) < _userCacheTTL {
+			u.ids[email] = e.Id
+			u.resolved[email] = e.Resolved
+			u.stale[email] = true
+		}
+	}
+	return u, nil
+}
+
+func readCacheFile(file string) (cacheFile, error) {
+	cf := cacheFile{}
+	bs, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cacheFile{Accounts: map[string]map[string]cacheEntry{}}, nil
+	}
+	if err != nil {
+		return cacheFile{}, err
+	}
+	if err := json.Unmarshal(bs, &cf); err != nil {
+		return cacheFile{}, fmt.Errorf("user cache %v: %v", file, err)
+	}
+	if cf.Accounts == nil {
+		cf.Accounts = map[string]map[string]cacheEntry{}
+	}
+	return cf, nil
+}
+
+// accountKey identifies the pagerduty account reached through url with token, without revealing the token
+func accountKey(url, token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(url+"\x00"+token)))[:16]
+}
+
+func (u *userCache) get(email string) (string, bool) {
+	u.RLock()
+	defer u.RUnlock()
+	id, ok := u.ids[email]
+	return id, ok
+}
+
+func (u *userCache) set(email, id string) {
+	u.Lock()
+	defer u.Unlock()
+	u.ids[email] = id
+	u.resolved[email] = time.Now()
+	delete(u.stale, email)
+}
+
+// isStale reports whether the id of email was read from the file, and not looked up since
+func (u *userCache) isStale(email string) bool {
+	u.RLock()
+	defer u.RUnlock()
+	return u.stale[email]
+}
+
+// remove drops the cached id of email, such as one pagerduty no longer knows
+func (u *userCache) remove(email string) {
+	u.Lock()
+	defer u.Unlock()
+	delete(u.ids, email)
+	delete(u.resolved, email)
+	delete(u.stale, email)
+}
+
+// save writes the cache to its file, if it has one, keeping the entries of other accounts.
+// the file is replaced in a single rename, so that concurrent runs never see it half written.
+// a file that cannot be read is replaced too, as its entries are lost anyway.
+func (u *userCache) save() error {
+	if u.file == "" {
+		return nil
+	}
+	u.RLock()
+	defer u.RUnlock()
+
+	cf, err := readCacheFile(u.file)
+	if err != nil {
+		cf = cacheFile{Accounts: map[string]map[string]cacheEntry{}}
+	}
+	entries := map[string]cacheEntry{}
+	for email, id := range u.ids {
+		entries[email] = cacheEntry{id, u.resolved[email]}
+	}
+	cf.Accounts[u.account] = entries
+	bs, err := json.MarshalIndent(cf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(u.file), filepath.Base(u.file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), u.file)
+}
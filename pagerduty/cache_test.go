@@ -0,0 +1,65 @@
+package pagerduty
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCacheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "users.json")
+	now := time.Now()
+
+	u, err := loadUserCache(f, "a", now)
+	require.NoError(t, err, "a missing file is an empty cache")
+	assert.Empty(t, u.ids)
+	u.set("foo@bar.com", "foo")
+	u.set("old@bar.com", "old")
+	u.resolved["old@bar.com"] = now.Add(-_userCacheTTL)
+	require.NoError(t, u.save())
+
+	other, err := loadUserCache(f, "b", now)
+	require.NoError(t, err)
+	assert.Empty(t, other.ids, "accounts should not share ids")
+	other.set("foo@bar.com", "other")
+	require.NoError(t, other.save())
+
+	u, err = loadUserCache(f, "a", now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo@bar.com": "foo"}, u.ids, "expired ids should be dropped")
+	assert.True(t, u.isStale("foo@bar.com"), "ids from the file should be checked again before they are trusted")
+
+	u.remove("foo@bar.com")
+	require.NoError(t, u.save())
+	u, err = loadUserCache(f, "a", now)
+	require.NoError(t, err)
+	assert.Empty(t, u.ids)
+	other, err = loadUserCache(f, "b", now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo@bar.com": "other"}, other.ids)
+
+	require.NoError(t, ioutil.WriteFile(f, []byte("💥"), 0644))
+	u, err = loadUserCache(f, "a", now)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "user cache "+f)
+	assert.Empty(t, u.ids, "a corrupt file should be an empty cache")
+	u.set("foo@bar.com", "foo")
+	require.NoError(t, u.save(), "a corrupt file should be replaced")
+	u, err = loadUserCache(f, "a", now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo@bar.com": "foo"}, u.ids)
+}
+
+func TestAccountKey(t *testing.T) {
+	assert.Equal(t, accountKey("u", "t"), accountKey("u", "t"))
+	assert.NotEqual(t, accountKey("u", "t"), accountKey("u", "t2"))
+	assert.NotContains(t, accountKey("u", "secret"), "secret")
+}
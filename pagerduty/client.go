@@ -2,16 +2,22 @@ package pagerduty
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/echohead/stickyshift"
+	"go.uber.org/multierr"
 )
 
 type (
@@ -19,7 +25,19 @@ type (
 		doer
 		url     string
 		headers map[string]string
-		userIds map[string]string
+		userIds *userCache
+		// failFast stops a sync at its first failure, rather than syncing what it can and reporting every failure
+		failFast bool
+		tokens   TokenSource
+	}
+
+	// coverage holds the spans of time each user's overrides cover, by user id.
+	// overrides that touch or overlap are joined, so that an override pagerduty split into pieces still covers its shift.
+	coverage map[string][]span
+
+	span struct {
+		start, end time.Time
+		overrides  []override
 	}
 
 	doer interface {
@@ -28,6 +46,7 @@ type (
 
 	// override represents a pagerduty override
 	override struct {
+		Id    string    `json:"id,omitempty"`
 		User  userRef   `json:"user"`
 		Start time.Time `json:"start"`
 		End   time.Time `json:"end"`
@@ -38,6 +57,7 @@ type (
 		Id    string `json:"id"`
 		Name  string `json:"name"`
 		Email string `json:"email"`
+		Role  string `json:"role"`
 	}
 
 	getScheduleResponse struct {
@@ -52,6 +72,21 @@ type (
 		Users []user `json:"users"`
 	}
 
+	getUserResponse struct {
+		User user `json:"user"`
+	}
+
+	createOverridesRequest struct {
+		Overrides []override `json:"overrides"`
+	}
+
+	// createOverrideResult is the outcome of creating one of the overrides of a createOverridesRequest
+	createOverrideResult struct {
+		Status   int      `json:"status"`
+		Errors   []string `json:"errors"`
+		Override override `json:"override"`
+	}
+
 	userRef struct {
 		Id   string `json:"id"`
 		Type string `json:"type"`
@@ -60,136 +95,394 @@ type (
 )
 
 const (
-	_getOverridesTimeFmt = "2006-01-02"
-	_pdUrl               = "https://api.pagerduty.com"
-	_tokenEnvVar         = "PD_TOKEN"
+	_tokenEnvVar = "PD_TOKEN"
+	// _preflightWorkers bounds how many users are looked up at once, to stay clear of pagerduty's rate limits
+	_preflightWorkers = 8
+	// _overridesPerRequest is how many overrides are created with each request
+	_overridesPerRequest = 50
 )
 
-func newClientImpl() (Client, error) {
-	token := os.Getenv(_tokenEnvVar)
-	if token == "" {
-		return nil, fmt.Errorf("environment variable $%s must be set", _tokenEnvVar)
+// _offCallRoles are the pagerduty roles of stakeholders, who cannot be put on call
+var _offCallRoles = map[string]bool{
+	"read_only_user":         true,
+	"read_only_limited_user": true,
+}
+
+func newClientImpl(o options) (Client, error) {
+	tokens := o.tokens
+	if tokens == nil {
+		var err error
+		if tokens, err = tokenSourceFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+
+	// tokens are got the way the client makes its other requests
+	if ts, ok := tokens.(interface {
+		forClient(doer, string) TokenSource
+	}); ok {
+		tokens = ts.forClient(o.httpClient, o.url)
+	}
+
+	userIds := newUserCache(nil)
+	if f := os.Getenv(_userCacheEnvVar); f != "" {
+		account, err := accountOf(context.Background(), tokens)
+		if err != nil {
+			return nil, err
+		}
+		// the cache only saves lookups, so one that cannot be read is started afresh
+		if userIds, err = loadUserCache(f, accountKey(o.url, account), time.Now()); err != nil {
+			log.Printf("ignoring user cache: %v", err)
+		}
 	}
 
 	return &clientImpl{
-		&http.Client{},
-		_pdUrl,
+		o.httpClient,
+		strings.TrimSuffix(o.url, "/"),
 		map[string]string{
-			"Authorization": token,
-			"Accept":        "application/vnd.pagerduty+json;version=2",
-			"Content-Type":  "application/json",
+			"Accept":       "application/vnd.pagerduty+json;version=2",
+			"Content-Type": "application/json",
+			"User-Agent":   o.userAgent,
 		},
-		map[string]string{},
+		userIds,
+		o.failFast,
+		tokens,
 	}, nil
 }
 
-func (c *clientImpl) Sync(sid string, shifts stickyshift.ShiftList) error {
+func (c *clientImpl) Sync(sid string, shifts stickyshift.ShiftList) (SyncResult, error) {
+	return c.SyncContext(context.Background(), sid, shifts)
+}
+
+func (c *clientImpl) SyncContext(ctx context.Context, sid string, shifts stickyshift.ShiftList) (SyncResult, error) {
+	res := SyncResult{Schedule: sid}
 	if len(shifts) < 1 {
-		return nil
+		return res, nil
 	}
-	if _, err := c.GetSchedule(sid); err != nil {
-		return err
+	if _, err := c.GetScheduleContext(ctx, sid); err != nil {
+		return res, err
 	}
 
-	os, err := c.getOverrides(sid, shifts[0].Start, shifts[len(shifts)-1].End)
+	emails := []string{}
+	for _, shift := range shifts {
+		if !shift.End.Before(time.Now()) {
+			emails = append(emails, shift.Email)
+		}
+	}
+	if err := c.CheckUsersContext(ctx, emails); err != nil {
+		return res, err
+	}
+
+	os, err := c.getOverrides(ctx, sid, shifts[0].Start, shifts[len(shifts)-1].End)
 	if err != nil {
-		return err
+		return res, err
 	}
 
+	existing := newCoverage(os)
+	// each failure is collected and the sync carries on, unless it fails fast or its context is done.
+	// either way, the result says which shifts were synced.
+	var errs error
+	stop := func(err error) bool {
+		errs = multierr.Append(errs, err)
+		return err != nil && (c.failFast || ctx.Err() != nil)
+	}
+	done := func() (SyncResult, error) {
+		res.sort()
+		return res, errs
+	}
+
+	// the overrides to create are settled before any are written, in the order of their shifts
+	missing := stickyshift.ShiftList{}
 	for _, shift := range shifts {
 		if shift.End.Before(time.Now()) {
+			res.add(ShiftResult{Shift: shift, Outcome: SkippedPast})
 			continue
 		}
-		exists, err := c.overrideExists(os, shift)
+		uid, err := c.userId(ctx, shift.Email)
 		if err != nil {
-			return err
-		}
-		if exists {
+			res.add(ShiftResult{Shift: shift, Outcome: Failed, Err: err})
+			if stop(err) {
+				return done()
+			}
 			continue
 		}
-
-		err = c.createOverride(sid, shift)
-		if err != nil {
-			return err
+		if ids, ok := existing.covers(uid, shift.Start, shift.End); ok {
+			res.add(ShiftResult{Shift: shift, Outcome: SkippedExisting, OverrideIds: ids})
+		} else {
+			missing = append(missing, shift)
 		}
 	}
 
-	return nil
+	for i := 0; i < len(missing); i += _overridesPerRequest {
+		end := i + _overridesPerRequest
+		if end > len(missing) {
+			end = len(missing)
+		}
+		rs, err := c.createOverrides(ctx, sid, missing[i:end])
+		res.add(rs...)
+		if stop(err) {
+			break
+		}
+	}
+	return done()
 }
 
 func (c *clientImpl) GetSchedule(id string) (Schedule, error) {
+	return c.GetScheduleContext(context.Background(), id)
+}
+
+func (c *clientImpl) GetScheduleContext(ctx context.Context, id string) (Schedule, error) {
 	resp := &getScheduleResponse{}
-	if err := c.get(fmt.Sprintf("/schedules/%v", id), &resp); err != nil {
+	if err := c.get(ctx, fmt.Sprintf("/schedules/%v", id), &resp); err != nil {
 		return Schedule{}, err
 	}
 	return resp.Schedule, nil
 }
 
-func (c *clientImpl) getUser(email string) (user, error) {
+// CheckUsers resolves each of the given emails to a pagerduty user, looking them up with a bounded pool of workers.
+// every email that is unknown, ambiguous or belongs to a user who cannot be on call is reported in a single error,
+// in order of email. users whose ids come from the user cache file are still checked, since they may have been
+// deactivated since.
+func (c *clientImpl) CheckUsers(emails []string) error {
+	return c.CheckUsersContext(context.Background(), emails)
+}
+
+func (c *clientImpl) CheckUsersContext(ctx context.Context, emails []string) error {
+	type result struct {
+		email string
+		err   error
+	}
+
+	todo := []string{}
+	seen := map[string]bool{}
+	for _, e := range emails {
+		if _, ok := c.userIds.get(e); (!ok || c.userIds.isStale(e)) && !seen[e] {
+			seen[e] = true
+			todo = append(todo, e)
+		}
+	}
+
+	in := make(chan string)
+	out := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < _preflightWorkers && i < len(todo); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range in {
+				out <- result{e, c.checkUser(ctx, e)}
+			}
+		}()
+	}
+	go func() {
+		for _, e := range todo {
+			in <- e
+		}
+		close(in)
+		wg.Wait()
+		close(out)
+	}()
+
+	results := []result{}
+	for r := range out {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].email < results[j].email
+	})
+	var errs error
+	for _, r := range results {
+		errs = multierr.Append(errs, r.err)
+	}
+	if len(todo) > 0 {
+		c.saveUserIds()
+	}
+	return errs
+}
+
+func (c *clientImpl) getUser(ctx context.Context, email string) (user, error) {
 	resp := &getUsersResponse{}
-	if err := c.get(fmt.Sprintf("/users?query=%s", url.QueryEscape(email)), resp); err != nil {
+	if err := c.get(ctx, fmt.Sprintf("/users?query=%s", url.QueryEscape(email)), resp); err != nil {
 		return user{}, err
 	}
-	if len(resp.Users) != 1 {
-		return user{}, fmt.Errorf("expected one user for %q, found %v", email, len(resp.Users))
+	matches := []user{}
+	for _, u := range resp.Users {
+		if strings.EqualFold(u.Email, email) {
+			matches = append(matches, u)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return user{}, fmt.Errorf("no pagerduty user has email %q; they may be unknown or deactivated", email)
+	case len(matches) > 1:
+		return user{}, fmt.Errorf("%v pagerduty users have email %q", len(matches), email)
 	}
-	if resp.Users[0].Email != email {
-		return user{}, fmt.Errorf("got user with email %q, expected %q", resp.Users[0].Email, email)
+	if err := canBeOnCall(email, matches[0]); err != nil {
+		return user{}, err
+	}
+	return matches[0], nil
+}
+
+func canBeOnCall(email string, u user) error {
+	if _offCallRoles[u.Role] {
+		return fmt.Errorf("pagerduty user %q has role %v, which cannot be on call", email, u.Role)
+	}
+	return nil
+}
+
+// checkUser makes sure email belongs to a pagerduty user who can be on call.
+// a cached id saves searching for the user, but they are still fetched by it, and searched for again if that fails.
+func (c *clientImpl) checkUser(ctx context.Context, email string) error {
+	if id, ok := c.userIds.get(email); ok {
+		resp := &getUserResponse{}
+		if err := c.get(ctx, "/users/"+url.PathEscape(id), resp); err == nil && strings.EqualFold(resp.User.Email, email) {
+			if err := canBeOnCall(email, resp.User); err != nil {
+				return err
+			}
+			c.userIds.set(email, id)
+			return nil
+		}
+		// the user may be gone, or have another email
+		c.userIds.remove(email)
 	}
-	return resp.Users[0], nil
+	_, err := c.userId(ctx, email)
+	return err
 }
 
-func (c *clientImpl) getOverrides(sid string, start, end time.Time) ([]override, error) {
+// getOverrides returns the overrides of schedule sid that overlap [start, end).
+// the window is given to the second, in UTC, so that it means the same whatever the account's time zone.
+func (c *clientImpl) getOverrides(ctx context.Context, sid string, start, end time.Time) ([]override, error) {
 	resp := &getOverridesResponse{}
-	t0 := start.Format(_getOverridesTimeFmt)
-	t1 := end.Format(_getOverridesTimeFmt)
-	url := fmt.Sprintf("/schedules/%v/overrides?since=%v&until=%v", sid, t0, t1)
-	if err := c.get(url, &resp); err != nil {
+	q := url.Values{}
+	q.Set("since", start.UTC().Format(time.RFC3339))
+	q.Set("until", end.UTC().Format(time.RFC3339))
+	q.Set("time_zone", "UTC")
+	if err := c.get(ctx, fmt.Sprintf("/schedules/%v/overrides?%v", sid, q.Encode()), &resp); err != nil {
 		return nil, err
 	}
 	return resp.Overrides, nil
 }
 
-func (c *clientImpl) createOverride(sid string, shift stickyshift.Shift) error {
-	uid, err := c.userId(shift.Email)
-	if err != nil {
-		return err
+func newCoverage(os []override) coverage {
+	byUser := map[string][]override{}
+	for _, o := range os {
+		byUser[o.User.Id] = append(byUser[o.User.Id], o)
 	}
-	o := override{
-		User: userRef{
-			Id:   uid,
-			Type: "user_reference",
-		},
-		Start: shift.Start,
-		End:   shift.End,
+	res := coverage{}
+	for uid, os := range byUser {
+		sort.Slice(os, func(i, j int) bool {
+			return os[i].Start.Before(os[j].Start)
+		})
+		spans := []span{}
+		for _, o := range os {
+			if n := len(spans); n > 0 && !o.Start.After(spans[n-1].end) {
+				if o.End.After(spans[n-1].end) {
+					spans[n-1].end = o.End
+				}
+				spans[n-1].overrides = append(spans[n-1].overrides, o)
+				continue
+			}
+			spans = append(spans, span{o.Start, o.End, []override{o}})
+		}
+		res[uid] = spans
 	}
-	return c.post(fmt.Sprintf("/schedules/%s/overrides", sid), o)
+	return res
 }
 
-func (c *clientImpl) overrideExists(os []override, shift stickyshift.Shift) (bool, error) {
-	uid, err := c.userId(shift.Email)
-	if err != nil {
-		return false, err
+// covers reports whether the overrides of user uid span all of [start, end), returning the ids of those that overlap it
+func (cv coverage) covers(uid string, start, end time.Time) ([]string, bool) {
+	for _, s := range cv[uid] {
+		if s.start.After(start) || s.end.Before(end) {
+			continue
+		}
+		ids := []string{}
+		for _, o := range s.overrides {
+			if o.Start.Before(end) && o.End.After(start) {
+				ids = append(ids, o.Id)
+			}
+		}
+		return ids, true
 	}
-	for _, o := range os {
-		if o.Start.Equal(shift.Start) &&
-			o.End.Equal(shift.End) &&
-			o.User.Id == uid {
-			return true, nil
+	return nil, false
+}
+
+// createOverrides creates an override for each of the shifts with a single request.
+// each override that pagerduty rejects is reported, so that a partial failure says which shifts were not synced.
+// if the request itself fails, every shift is returned as failed with its error.
+func (c *clientImpl) createOverrides(ctx context.Context, sid string, shifts stickyshift.ShiftList) ([]ShiftResult, error) {
+	failed := func(err error) ([]ShiftResult, error) {
+		rs := []ShiftResult{}
+		for _, shift := range shifts {
+			rs = append(rs, ShiftResult{Shift: shift, Outcome: Failed, Err: err})
 		}
+		return rs, err
+	}
+
+	req := createOverridesRequest{}
+	for _, shift := range shifts {
+		uid, err := c.userId(ctx, shift.Email)
+		if err != nil {
+			return failed(err)
+		}
+		// pagerduty overrides have no field for a note, so the shift's metadata stays in the schedule file only
+		req.Overrides = append(req.Overrides, override{
+			User: userRef{
+				Id:   uid,
+				Type: "user_reference",
+			},
+			Start: shift.Start,
+			End:   shift.End,
+		})
+	}
+
+	results := []createOverrideResult{}
+	if err := c.post(ctx, fmt.Sprintf("/schedules/%s/overrides", sid), req, &results); err != nil {
+		return failed(err)
+	}
+	if len(results) != len(shifts) {
+		return failed(fmt.Errorf("expected results for %v overrides, got %v", len(shifts), len(results)))
+	}
+	rs := []ShiftResult{}
+	var errs error
+	invalidated := false
+	for i, r := range results {
+		s := shifts[i]
+		if r.Status == http.StatusCreated {
+			rs = append(rs, ShiftResult{Shift: s, Outcome: Created, OverrideIds: []string{r.Override.Id}})
+			continue
+		}
+		err := fmt.Errorf("override for %v from %v to %v failed with status %v: %v",
+			s.Email, s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339), r.Status, strings.Join(r.Errors, ", "))
+		rs = append(rs, ShiftResult{Shift: s, Outcome: Failed, Err: err})
+		errs = multierr.Append(errs, err)
+		if r.Status == http.StatusNotFound {
+			// the cached id of the user may be stale, so it is looked up again next time
+			c.userIds.remove(s.Email)
+			invalidated = true
+		}
+	}
+	if invalidated {
+		c.saveUserIds()
+	}
+	return rs, errs
+}
+
+// saveUserIds saves the user cache for later runs. the cache only saves lookups, so failing to save it does not fail the sync.
+func (c *clientImpl) saveUserIds() {
+	if err := c.userIds.save(); err != nil {
+		log.Printf("failed to save user cache: %v", err)
 	}
-	return false, nil
 }
 
-func (c *clientImpl) userId(email string) (string, error) {
-	if id, ok := c.userIds[email]; ok {
+func (c *clientImpl) userId(ctx context.Context, email string) (string, error) {
+	if id, ok := c.userIds.get(email); ok {
 		return id, nil
 	}
-	user, err := c.getUser(email)
+	user, err := c.getUser(ctx, email)
 	if err != nil {
 		return "", err
 	}
-	c.userIds[email] = user.Id
+	c.userIds.set(email, user.Id)
 	return user.Id, nil
 }
 
@@ -199,12 +492,19 @@ func (c *clientImpl) setHeaders(r *http.Request) {
 	}
 }
 
-func (c *clientImpl) request(method, path string, wantStatus int, body io.Reader) ([]byte, error) {
-	req, err := http.NewRequest(method, c.url+path, body)
+func (c *clientImpl) request(ctx context.Context, method, path string, wantStatus int, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
 	if err != nil {
 		return nil, err
 	}
 	c.setHeaders(req)
+	if c.tokens != nil {
+		auth, err := c.tokens.Authorization(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth)
+	}
 	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
@@ -220,19 +520,22 @@ func (c *clientImpl) request(method, path string, wantStatus int, body io.Reader
 	return bs, nil
 }
 
-func (c *clientImpl) get(path string, into interface{}) error {
-	bs, err := c.request(http.MethodGet, path, http.StatusOK, nil)
+func (c *clientImpl) get(ctx context.Context, path string, into interface{}) error {
+	bs, err := c.request(ctx, http.MethodGet, path, http.StatusOK, nil)
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal(bs, &into)
 }
 
-func (c *clientImpl) post(path string, body interface{}) error {
+func (c *clientImpl) post(ctx context.Context, path string, body, into interface{}) error {
 	bs, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	_, err = c.request(http.MethodPost, path, http.StatusCreated, bytes.NewReader(bs))
-	return err
+	bs, err = c.request(ctx, http.MethodPost, path, http.StatusCreated, bytes.NewReader(bs))
+	if err != nil || into == nil {
+		return err
+	}
+	return json.Unmarshal(bs, into)
 }
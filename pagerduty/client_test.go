@@ -2,18 +2,24 @@ package pagerduty
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/echohead/stickyshift"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
 )
 
 type failDoer struct{}
@@ -106,6 +112,64 @@ func TestNew(t *testing.T) {
 	c, err = New()
 	assert.NotNil(t, c)
 	assert.NoError(t, err)
+
+	proxied := &http.Client{Transport: &http.Transport{}}
+	c, err = New(WithBaseURL(EUBaseURL+"/"), WithHTTPClient(proxied), WithTimeout(time.Second), WithUserAgent("ua"))
+	require.NoError(t, err)
+	impl := c.(*clientImpl)
+	assert.Equal(t, EUBaseURL, impl.url)
+	assert.Equal(t, "ua", impl.headers["User-Agent"])
+	assert.Equal(t, time.Second, impl.doer.(*http.Client).Timeout)
+	assert.Equal(t, proxied.Transport, impl.doer.(*http.Client).Transport)
+	assert.Zero(t, proxied.Timeout, "the given client should not be modified")
+
+	c, err = New(WithHTTPClient(nil), WithTimeout(time.Second))
+	require.NoError(t, err, "a nil client should keep the default")
+	assert.Equal(t, time.Second, c.(*clientImpl).doer.(*http.Client).Timeout)
+
+	for v, val := range map[string]string{_urlEnvVar: EUBaseURL, _httpTimeoutEnvVar: "30s", _userAgentEnvVar: "ua"} {
+		require.NoError(t, os.Setenv(v, val))
+		defer os.Unsetenv(v)
+	}
+	c, err = New()
+	require.NoError(t, err)
+	impl = c.(*clientImpl)
+	assert.Equal(t, EUBaseURL, impl.url, "defaults should be taken from the environment")
+	assert.Equal(t, 30*time.Second, impl.doer.(*http.Client).Timeout)
+	assert.Equal(t, "ua", impl.headers["User-Agent"])
+	c, err = New(WithBaseURL(USBaseURL))
+	require.NoError(t, err)
+	assert.Equal(t, USBaseURL, c.(*clientImpl).url, "options should take precedence over the environment")
+
+	require.NoError(t, os.Setenv(_httpTimeoutEnvVar, "soon"))
+	_, err = New()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), _httpTimeoutEnvVar)
+	require.NoError(t, os.Unsetenv(_httpTimeoutEnvVar))
+	require.NoError(t, os.Unsetenv(_urlEnvVar))
+	require.NoError(t, os.Unsetenv(_userAgentEnvVar))
+
+	c, err = New()
+	require.NoError(t, err)
+	impl = c.(*clientImpl)
+	assert.Equal(t, USBaseURL, impl.url)
+	assert.Equal(t, _defaultUserAgent, impl.headers["User-Agent"])
+	assert.False(t, impl.failFast)
+
+	c, err = New(WithFailFast())
+	require.NoError(t, err)
+	assert.True(t, c.(*clientImpl).failFast)
+
+	c, err = New(WithTokenSource(TokenFile("_")))
+	require.NoError(t, err)
+	assert.Equal(t, TokenFile("_"), c.(*clientImpl).tokens)
+	assert.Empty(t, c.(*clientImpl).headers["Authorization"], "the token should not be kept with the other headers")
+
+	require.NoError(t, os.Setenv(_userCacheEnvVar, "/"))
+	defer os.Unsetenv(_userCacheEnvVar)
+	c, err = New()
+	require.NoError(t, err, "an unreadable user cache should be ignored")
+	assert.Empty(t, c.(*clientImpl).userIds.ids)
 }
 
 func TestSetHeaders(t *testing.T) {
@@ -172,8 +236,8 @@ func TestRequest(t *testing.T) {
 		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
-			c := &clientImpl{test.d, test.url, _headers, map[string]string{}}
-			_, err := c.request(test.method, "_", http.StatusOK, nil)
+			c := &clientImpl{test.d, test.url, _headers, newUserCache(nil), false, nil}
+			_, err := c.request(context.Background(), test.method, "_", http.StatusOK, nil)
 			if test.wantErr != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), test.wantErr)
@@ -187,8 +251,8 @@ func TestRequest(t *testing.T) {
 func TestGet(t *testing.T) {
 	res := ""
 
-	c := &clientImpl{_clientFail, "http://_", _headers, map[string]string{}}
-	err := c.get("_", &res)
+	c := &clientImpl{_clientFail, "http://_", _headers, newUserCache(nil), false, nil}
+	err := c.get(context.Background(), "_", &res)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failDoer")
 	assert.Empty(t, res)
@@ -200,23 +264,30 @@ func TestGet(t *testing.T) {
 		},
 		"http://_",
 		_headers,
-		map[string]string{},
+		newUserCache(nil),
+		false,
+		nil,
 	}
-	err = c.get("_", &res)
+	err = c.get(context.Background(), "_", &res)
 	assert.NoError(t, err)
 	assert.Equal(t, "x", res)
 }
 
 func TestPost(t *testing.T) {
-	c := &clientImpl{_clientFail, "http://_", _headers, map[string]string{}}
+	c := &clientImpl{_clientFail, "http://_", _headers, newUserCache(nil), false, nil}
 
-	err := c.post("_", math.Inf(1))
+	err := c.post(context.Background(), "_", math.Inf(1), nil)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "unsupported value")
 
-	err = c.post("_", "_")
+	err = c.post(context.Background(), "_", "_", nil)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failDoer")
+
+	res := ""
+	c = &clientImpl{newMockDoer(http.StatusCreated, `"x"`), "http://_", _headers, newUserCache(nil), false, nil}
+	require.NoError(t, c.post(context.Background(), "_", "_", &res))
+	assert.Equal(t, "x", res)
 }
 
 func TestSync(t *testing.T) {
@@ -266,7 +337,6 @@ func TestSync(t *testing.T) {
 			msg: "error getting user",
 			d: newMultiDoer([]resp{
 				{http.StatusOK, `{"id": "_", "name": "_"}`},
-				{http.StatusOK, `{"overrides": []}`},
 				{http.StatusBadGateway, "_"},
 			}),
 			in:      unknownUserShifts,
@@ -280,6 +350,22 @@ func TestSync(t *testing.T) {
 			}),
 			in: shifts,
 		},
+		{
+			msg: "override already exists in another offset",
+			d: newMultiDoer([]resp{
+				{http.StatusOK, `{"id": "_", "name": "_"}`},
+				{http.StatusOK, `{"overrides": [{"user": {"id": "someID"}, "start": "1970-01-01T07:00:00Z", "end": "2100-01-01T08:00:00+01:00"}]}`},
+			}),
+			in: shifts,
+		},
+		{
+			msg: "override already exists, split in two",
+			d: newMultiDoer([]resp{
+				{http.StatusOK, `{"id": "_", "name": "_"}`},
+				{http.StatusOK, `{"overrides": [{"user": {"id": "someID"}, "start": "2000-01-01T00:00:00Z", "end": "2100-01-01T07:00:00Z"}, {"user": {"id": "someID"}, "start": "1970-01-01T07:00:00Z", "end": "2000-01-01T00:00:00Z"}]}`},
+			}),
+			in: shifts,
+		},
 		{
 			msg: "create override fails",
 			d: newMultiDoer([]resp{
@@ -295,14 +381,14 @@ func TestSync(t *testing.T) {
 			d: newMultiDoer([]resp{
 				{http.StatusOK, `{"id": "_", "name": "_"}`},
 				{http.StatusOK, `{"overrides": []}`},
-				{http.StatusCreated, "_"},
+				{http.StatusCreated, `[{"status": 201}]`},
 			}),
 			in: shifts,
 		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
-			c := &clientImpl{test.d, "_", _headers, users}
-			err := c.Sync("_", test.in)
+			c := &clientImpl{test.d, "_", _headers, newUserCache(users), false, nil}
+			_, err := c.Sync("_", test.in)
 			if test.wantErr == "" {
 				require.NoError(t, err)
 				return
@@ -313,6 +399,26 @@ func TestSync(t *testing.T) {
 	}
 }
 
+func TestSyncContext(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer hang.Close()
+
+	c := &clientImpl{&http.Client{}, hang.URL, _headers, newUserCache(nil), false, nil}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	shifts := stickyshift.ShiftList{{Email: "foo@bar.com", Start: time.Now(), End: time.Now().Add(time.Hour)}}
+	_, err := c.SyncContext(ctx, "_", shifts)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "a hung call should end with its context: %v", err)
+}
+
 func TestGetSchedule(t *testing.T) {
 	for _, test := range []struct {
 		msg     string
@@ -337,7 +443,7 @@ func TestGetSchedule(t *testing.T) {
 		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
-			c := &clientImpl{newMockDoer(test.status, test.body), "_", _headers, map[string]string{}}
+			c := &clientImpl{newMockDoer(test.status, test.body), "_", _headers, newUserCache(nil), false, nil}
 			res, err := c.GetSchedule("_")
 			if test.wantErr {
 				assert.Error(t, err)
@@ -387,8 +493,8 @@ func TestGetOverrides(t *testing.T) {
 		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
-			c := &clientImpl{newMockDoer(test.status, test.body), "_", _headers, map[string]string{}}
-			res, err := c.getOverrides("_", time.Now(), time.Now())
+			c := &clientImpl{newMockDoer(test.status, test.body), "_", _headers, newUserCache(nil), false, nil}
+			res, err := c.getOverrides(context.Background(), "_", time.Now(), time.Now())
 			if test.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -399,6 +505,62 @@ func TestGetOverrides(t *testing.T) {
 	}
 }
 
+type urlDoer struct {
+	urls []string
+}
+
+func (d *urlDoer) Do(req *http.Request) (*http.Response, error) {
+	d.urls = append(d.urls, req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       noopCloser{bytes.NewBufferString(`{"overrides": []}`)},
+	}, nil
+}
+
+func TestGetOverridesWindow(t *testing.T) {
+	start, err := time.Parse(time.RFC3339, "2018-05-18T23:30:00-07:00")
+	require.NoError(t, err)
+	d := &urlDoer{}
+	c := &clientImpl{d, "_", _headers, newUserCache(nil), false, nil}
+	_, err = c.getOverrides(context.Background(), "abc", start, start.Add(90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_/schedules/abc/overrides?since=2018-05-19T06%3A30%3A00Z&time_zone=UTC&until=2018-05-19T08%3A00%3A00Z"}, d.urls)
+}
+
+func TestCoverage(t *testing.T) {
+	at := func(h int) time.Time {
+		return time.Date(2018, 1, 1, h, 0, 0, 0, time.UTC)
+	}
+	pst := time.FixedZone("PST", -8*60*60)
+	cv := newCoverage([]override{
+		{Id: "a4", User: userRef{Id: "a"}, Start: at(4), End: at(6)},
+		{Id: "a0", User: userRef{Id: "a"}, Start: at(0).In(pst), End: at(2).In(pst)},
+		{Id: "a2", User: userRef{Id: "a"}, Start: at(2), End: at(3)},
+		{Id: "a1", User: userRef{Id: "a"}, Start: at(1), End: at(2)},
+		{Id: "b3", User: userRef{Id: "b"}, Start: at(3), End: at(4)},
+	})
+	for _, test := range []struct {
+		msg        string
+		uid        string
+		start, end time.Time
+		want       []string
+	}{
+		{"touching and overlapping overrides should join", "a", at(0), at(3), []string{"a0", "a1", "a2"}},
+		{"offsets should not matter", "a", at(1).In(pst), at(2).In(pst), []string{"a0", "a1"}},
+		{"only overlapping overrides are listed", "a", at(5), at(6), []string{"a4"}},
+		{"a gap should not be covered", "a", at(2), at(5), nil},
+		{"an uncovered window", "a", at(3), at(4), nil},
+		{"another user's overrides should not count", "b", at(0), at(3), nil},
+		{"a user without overrides", "c", at(0), at(1), nil},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			ids, ok := cv.covers(test.uid, test.start, test.end)
+			assert.Equal(t, test.want != nil, ok)
+			assert.Equal(t, test.want, ids)
+		})
+	}
+}
+
 func TestGetUser(t *testing.T) {
 	for _, test := range []struct {
 		msg     string
@@ -412,26 +574,38 @@ func TestGetUser(t *testing.T) {
 			wantErr: "got 500",
 		},
 		{
-			msg:     "multiple users returned",
+			msg:     "no users returned",
 			status:  http.StatusOK,
-			body:    `{"users": [{}, {}]}`,
-			wantErr: "expected one user",
+			body:    `{"users": []}`,
+			wantErr: "no pagerduty user has email",
 		},
 		{
 			msg:     "mismatched email",
 			status:  http.StatusOK,
 			body:    `{"users": [{"email": "💥"}]}`,
-			wantErr: "got user with email",
+			wantErr: "no pagerduty user has email",
+		},
+		{
+			msg:     "ambiguous",
+			status:  http.StatusOK,
+			body:    `{"users": [{"email": "foo@bar.com"}, {"email": "FOO@bar.com"}]}`,
+			wantErr: "2 pagerduty users have email",
+		},
+		{
+			msg:     "stakeholder",
+			status:  http.StatusOK,
+			body:    `{"users": [{"email": "foo@bar.com", "role": "read_only_user"}]}`,
+			wantErr: "cannot be on call",
 		},
 		{
 			msg:    "ok",
 			status: http.StatusOK,
-			body:   `{"users": [{"email": "foo@bar.com"}]}`,
+			body:   `{"users": [{"email": "foo@bar.com.au"}, {"email": "foo@bar.com"}]}`,
 		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
-			c := &clientImpl{newMockDoer(test.status, test.body), "_", _headers, map[string]string{}}
-			res, err := c.getUser("foo@bar.com")
+			c := &clientImpl{newMockDoer(test.status, test.body), "_", _headers, newUserCache(nil), false, nil}
+			res, err := c.getUser(context.Background(), "foo@bar.com")
 			if test.wantErr != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), test.wantErr)
@@ -443,34 +617,305 @@ func TestGetUser(t *testing.T) {
 	}
 }
 
-func TestCreateOverride(t *testing.T) {
+// userDoer answers user lookups from a fixed set of users, and may be used concurrently
+type userDoer struct {
+	users map[string]string
+}
+
+func (d *userDoer) Do(req *http.Request) (*http.Response, error) {
+	if id := strings.TrimPrefix(req.URL.Path, "/users/"); id != req.URL.Path {
+		for email, uid := range d.users {
+			if uid == id {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       noopCloser{bytes.NewBufferString(fmt.Sprintf(`{"user": {"id": %q, "email": %q}}`, id, email))},
+				}, nil
+			}
+		}
+		return &http.Response{StatusCode: http.StatusNotFound, Body: noopCloser{bytes.NewBufferString("_")}}, nil
+	}
+	email := req.URL.Query().Get("query")
+	if email == "💥" {
+		return nil, errors.New("userDoer")
+	}
+	body := `{"users": []}`
+	if id, ok := d.users[email]; ok {
+		body = fmt.Sprintf(`{"users": [{"id": %q, "email": %q}]}`, id, email)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       noopCloser{bytes.NewBufferString(body)},
+	}, nil
+}
+
+func TestCheckUsers(t *testing.T) {
+	d := &userDoer{map[string]string{}}
+	emails := []string{}
+	for i := 0; i < 3*_preflightWorkers; i++ {
+		e := fmt.Sprintf("%v@bar.com", i)
+		d.users[e] = fmt.Sprint(i)
+		emails = append(emails, e, e)
+	}
+
+	c := &clientImpl{d, "http://_", _headers, newUserCache(map[string]string{"cached@bar.com": "c"}), false, nil}
+	require.NoError(t, c.CheckUsers(append(emails, "cached@bar.com")))
+	assert.Len(t, c.userIds.ids, 3*_preflightWorkers+1)
+	assert.Equal(t, "7", c.userIds.ids["7@bar.com"])
+
+	err := c.CheckUsers([]string{"b@bar.com", "0@bar.com", "💥", "a@bar.com"})
+	require.Error(t, err)
+	errs := multierr.Errors(err)
+	require.Len(t, errs, 3, "every bad user should be reported")
+	assert.Contains(t, errs[0].Error(), `"a@bar.com"`)
+	assert.Contains(t, errs[1].Error(), `"b@bar.com"`)
+	assert.Contains(t, errs[2].Error(), "userDoer")
+
+	d.users["new@bar.com"] = "new"
+	c.userIds.file = "/"
+	assert.NoError(t, c.CheckUsers([]string{"new@bar.com"}), "failing to save the user cache should not fail the check")
+
+	c.userIds = newUserCache(map[string]string{"1@bar.com": "1", "gone@bar.com": "g", "moved@bar.com": "old"})
+	d.users["moved@bar.com"] = "m"
+	for e := range c.userIds.ids {
+		c.userIds.stale[e] = true
+	}
+	err = c.CheckUsers([]string{"1@bar.com", "gone@bar.com", "moved@bar.com"})
+	require.Error(t, err, "users from the cache file should still be checked")
+	assert.Contains(t, err.Error(), `"gone@bar.com"`)
+	assert.NotContains(t, err.Error(), `"1@bar.com"`)
+	assert.NotContains(t, err.Error(), `"moved@bar.com"`)
+	assert.Equal(t, map[string]string{"1@bar.com": "1", "moved@bar.com": "m"}, c.userIds.ids, "stale ids should be replaced")
+	assert.False(t, c.userIds.isStale("1@bar.com"))
+}
+
+// postDoer records the number of overrides in each post, creating all of them once the first fail posts are rejected
+type postDoer struct {
+	posts []int
+	fail  int
+}
+
+func (d *postDoer) Do(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusOK, `{"overrides": []}`
+	if req.Method == http.MethodPost {
+		status = http.StatusCreated
+		r := createOverridesRequest{}
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+			return nil, err
+		}
+		d.posts = append(d.posts, len(r.Overrides))
+		if len(d.posts) <= d.fail {
+			return &http.Response{
+				StatusCode: http.StatusBadGateway,
+				Body:       noopCloser{bytes.NewBufferString("_")},
+			}, nil
+		}
+		body = "[" + strings.TrimSuffix(strings.Repeat(`{"status": 201},`, len(r.Overrides)), ",") + "]"
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       noopCloser{bytes.NewBufferString(body)},
+	}, nil
+}
+
+func TestUserCache(t *testing.T) {
+	u := newUserCache(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u.set(fmt.Sprint(i), fmt.Sprint(i))
+			u.get(fmt.Sprint(i - 1))
+		}(i)
+	}
+	wg.Wait()
+	id, ok := u.get("3")
+	assert.True(t, ok)
+	assert.Equal(t, "3", id)
+	_, ok = u.get("_")
+	assert.False(t, ok)
+}
+
+func TestSyncBatches(t *testing.T) {
+	start := time.Now().Add(time.Hour).Truncate(time.Hour)
+	shifts := stickyshift.ShiftList{}
+	for i := 0; i < 2*_overridesPerRequest+1; i++ {
+		shifts = append(shifts, stickyshift.Shift{Email: "foo@bar.com", Start: start, End: start.Add(time.Hour)})
+		start = start.Add(time.Hour)
+	}
+
+	d := &postDoer{}
+	c := &clientImpl{d, "_", _headers, newUserCache(map[string]string{"foo@bar.com": "someID"}), false, nil}
+	res, err := c.Sync("_", shifts)
+	require.NoError(t, err)
+	assert.Equal(t, []int{_overridesPerRequest, _overridesPerRequest, 1}, d.posts)
+	assert.Equal(t, len(shifts), res.Count(Created))
+}
+
+func TestSyncFailures(t *testing.T) {
+	start := time.Now().Add(time.Hour).Truncate(time.Hour)
+	shifts := stickyshift.ShiftList{}
+	for i := 0; i < 3*_overridesPerRequest; i++ {
+		shifts = append(shifts, stickyshift.Shift{Email: "foo@bar.com", Start: start, End: start.Add(time.Hour)})
+		start = start.Add(time.Hour)
+	}
+	users := map[string]string{"foo@bar.com": "someID"}
+
+	d := &postDoer{fail: 1}
+	c := &clientImpl{d, "_", _headers, newUserCache(users), false, nil}
+	res, err := c.Sync("_", shifts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "got 502")
+	assert.Len(t, d.posts, 3, "the sync should carry on past a failed request")
+	assert.Equal(t, _overridesPerRequest, res.Count(Failed))
+	assert.Equal(t, 2*_overridesPerRequest, res.Count(Created))
+
+	d = &postDoer{fail: 2}
+	c = &clientImpl{d, "_", _headers, newUserCache(users), false, nil}
+	_, err = c.Sync("_", shifts)
+	assert.Len(t, multierr.Errors(err), 2, "every failure should be reported")
+
+	d = &postDoer{fail: 1}
+	c = &clientImpl{d, "_", _headers, newUserCache(users), true, nil}
+	res, err = c.Sync("_", shifts)
+	require.Error(t, err)
+	assert.Len(t, d.posts, 1, "a fail fast sync should stop at the first failure")
+	assert.Equal(t, _overridesPerRequest, res.Count(Failed))
+	assert.Zero(t, res.Count(Created))
+}
+
+func TestCreateOverrides(t *testing.T) {
+	t0, err := time.Parse(time.RFC3339, "2100-01-01T00:00:00-07:00")
+	require.NoError(t, err)
+	t1 := t0.Add(time.Hour)
+	shifts := stickyshift.ShiftList{
+		{Email: "foo@bar.com", Start: t0, End: t1},
+		{Email: "baz@bar.com", Start: t1, End: t1.Add(time.Hour)},
+	}
+
+	users := map[string]string{"foo@bar.com": "foo", "baz@bar.com": "baz"}
+
 	for _, test := range []struct {
 		msg     string
 		d       doer
+		users   map[string]string
+		dropped string
 		wantErr string
 	}{
 		{
 			msg:     "fail to get user",
 			d:       _clientBadRequest,
+			users:   map[string]string{"foo@bar.com": "foo"},
+			wantErr: "got 400",
+		},
+		{
+			msg: "request fails",
+			d: newMultiDoer([]resp{
+				{http.StatusBadRequest, "_"},
+			}),
 			wantErr: "got 400",
 		},
+		{
+			msg: "missing results",
+			d: newMultiDoer([]resp{
+				{http.StatusCreated, `[{"status": 201}]`},
+			}),
+			wantErr: "expected results for 2 overrides, got 1",
+		},
+		{
+			msg: "partial failure",
+			d: newMultiDoer([]resp{
+				{http.StatusCreated, `[{"status": 201}, {"status": 400, "errors": ["User cannot be on call", "Invalid time"]}]`},
+			}),
+			wantErr: "override for baz@bar.com from 2100-01-01T01:00:00-07:00 to 2100-01-01T02:00:00-07:00 failed with status 400: " +
+				"User cannot be on call, Invalid time",
+		},
+		{
+			msg: "unknown user id",
+			d: newMultiDoer([]resp{
+				{http.StatusCreated, `[{"status": 404, "errors": ["User not found"]}, {"status": 201}]`},
+			}),
+			dropped: "foo@bar.com",
+			wantErr: "override for foo@bar.com",
+		},
 		{
 			msg: "ok",
 			d: newMultiDoer([]resp{
-				{http.StatusOK, `{"users": [{"email": "foo@bar.com"}]}`},
-				{http.StatusCreated, "_"},
+				{http.StatusCreated, `[{"status": 201, "override": {"id": "o1"}}, {"status": 201, "override": {"id": "o2"}}]`},
 			}),
 		},
 	} {
 		t.Run(test.msg, func(t *testing.T) {
-			c := &clientImpl{test.d, "_", _headers, map[string]string{}}
-			err := c.createOverride("_", stickyshift.Shift{Email: "foo@bar.com"})
+			if test.users == nil {
+				test.users = map[string]string{}
+				for e, id := range users {
+					test.users[e] = id
+				}
+			}
+			c := &clientImpl{test.d, "_", _headers, newUserCache(test.users), false, nil}
+			rs, err := c.createOverrides(context.Background(), "_", shifts)
+			require.Len(t, rs, len(shifts), "every shift should have a result")
 			if test.wantErr != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), test.wantErr)
+				assert.NotZero(t, SyncResult{Shifts: rs}.Count(Failed), "a failure should be in the results")
+				if test.dropped != "" {
+					_, ok := c.userIds.get(test.dropped)
+					assert.False(t, ok, "a user id pagerduty doesn't know should be dropped from the cache")
+				}
 				return
 			}
 			require.NoError(t, err)
+			assert.Equal(t, []ShiftResult{
+				{Shift: shifts[0], Outcome: Created, OverrideIds: []string{"o1"}},
+				{Shift: shifts[1], Outcome: Created, OverrideIds: []string{"o2"}},
+			}, rs)
 		})
 	}
 }
+
+func TestSyncResult(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	at := func(h int) time.Time {
+		return now.Add(time.Duration(h) * time.Hour)
+	}
+	shifts := stickyshift.ShiftList{
+		{Email: "foo@bar.com", Start: at(-2), End: at(-1)},
+		{Email: "foo@bar.com", Start: at(1), End: at(2)},
+		{Email: "baz@bar.com", Start: at(2), End: at(3)},
+		{Email: "foo@bar.com", Start: at(3), End: at(4)},
+	}
+	existing, err := json.Marshal(getOverridesResponse{Overrides: []override{
+		{Id: "old", User: userRef{Id: "baz"}, Start: at(2), End: at(3)},
+	}})
+	require.NoError(t, err)
+
+	c := &clientImpl{newMultiDoer([]resp{
+		{http.StatusOK, `{"id": "_", "name": "_"}`},
+		{http.StatusOK, string(existing)},
+		{http.StatusCreated, `[{"status": 201, "override": {"id": "new"}}, {"status": 400, "errors": ["Invalid time"]}]`},
+	}), "_", _headers, newUserCache(map[string]string{"foo@bar.com": "foo", "baz@bar.com": "baz"}), false, nil}
+	res, err := c.Sync("sid", shifts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid time")
+
+	assert.Equal(t, "sid", res.Schedule)
+	require.Len(t, res.Shifts, len(shifts))
+	for i, want := range []struct {
+		outcome Outcome
+		ids     []string
+	}{
+		{SkippedPast, nil},
+		{Created, []string{"new"}},
+		{SkippedExisting, []string{"old"}},
+		{Failed, nil},
+	} {
+		r := res.Shifts[i]
+		assert.Equal(t, shifts[i], r.Shift, "results should be in order of their shifts")
+		assert.Equal(t, want.outcome, r.Outcome, "shift %v", i)
+		assert.Equal(t, want.ids, r.OverrideIds, "shift %v", i)
+		assert.Equal(t, want.outcome == Failed, r.Err != nil, "shift %v", i)
+	}
+	assert.Equal(t, 1, res.Count(Created))
+	assert.Equal(t, 1, res.Count(Failed))
+}
@@ -1,18 +1,35 @@
 package pagerduty
 
 import (
+	"context"
+
 	"github.com/echohead/stickyshift"
 )
 
-func New() (Client, error) {
-	return newClientImpl()
+// New makes a Client configured by the given options, authenticated with the token in $PD_TOKEN unless WithTokenSource says otherwise.
+// options that are not given are taken from the environment, as each option says.
+func New(opts ...Option) (Client, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newClientImpl(o)
 }
 
 type (
 	// Client writes and reads to/from pagerduty API
 	Client interface {
-		Sync(string, stickyshift.ShiftList) error
+		// Sync creates the overrides of the given shifts that the schedule lacks, and says what it did with each shift.
+		// it carries on past shifts that fail and reports them all at the end, unless the client was made WithFailFast.
+		Sync(string, stickyshift.ShiftList) (SyncResult, error)
 		GetSchedule(string) (Schedule, error)
+		// CheckUsers reports every email that does not belong to exactly one pagerduty user who can be on call
+		CheckUsers([]string) error
+
+		// the Context variants stop waiting on pagerduty once their context is done
+		SyncContext(context.Context, string, stickyshift.ShiftList) (SyncResult, error)
+		GetScheduleContext(context.Context, string) (Schedule, error)
+		CheckUsersContext(context.Context, []string) error
 	}
 
 	// Schedule holds only the needed fields of a pagerduty schedule
@@ -0,0 +1,118 @@
+package pagerduty
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// USBaseURL is the address of pagerduty's API in its US service region, which is used by default
+	USBaseURL = "https://api.pagerduty.com"
+	// EUBaseURL is the address of pagerduty's API in its EU service region
+	EUBaseURL = "https://api.eu.pagerduty.com"
+
+	_defaultUserAgent = "stickyshift"
+
+	_urlEnvVar         = "PD_URL"
+	_httpTimeoutEnvVar = "PD_HTTP_TIMEOUT"
+	_userAgentEnvVar   = "PD_USER_AGENT"
+)
+
+type (
+	// Option configures a Client made by New
+	Option func(*options)
+
+	options struct {
+		url        string
+		httpClient *http.Client
+		timeout    time.Duration
+		userAgent  string
+		failFast   bool
+		tokens     TokenSource
+	}
+)
+
+// WithBaseURL points the client at another address of pagerduty's API, such as EUBaseURL or a mock server.
+// by default, the address is taken from $PD_URL, or is USBaseURL if that is not set.
+func WithBaseURL(url string) Option {
+	return func(o *options) {
+		o.url = url
+	}
+}
+
+// WithHTTPClient makes requests with the given client, such as one with its own proxy or transport.
+// by default, proxies are taken from the environment, as with http.ProxyFromEnvironment. a nil client keeps the default.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		if c != nil {
+			o.httpClient = c
+		}
+	}
+}
+
+// WithTimeout bounds how long each request may take.
+// by default, the bound is taken from $PD_HTTP_TIMEOUT, as in "30s", and requests are not bounded if that is not set.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithUserAgent sets the User-Agent header of each request, which is taken from $PD_USER_AGENT by default
+func WithUserAgent(ua string) Option {
+	return func(o *options) {
+		o.userAgent = ua
+	}
+}
+
+// WithFailFast stops each sync at its first failure.
+// by default, a sync creates every override it can and reports all of its failures together.
+func WithFailFast() Option {
+	return func(o *options) {
+		o.failFast = true
+	}
+}
+
+// WithTokenSource authenticates with the given source of tokens.
+// by default, the source is taken from the environment: $PD_TOKEN, $PD_TOKEN_FILE, $PD_TOKEN_COMMAND
+// or $PD_OAUTH_CLIENT_ID, $PD_OAUTH_CLIENT_SECRET and $PD_OAUTH_SCOPES, whichever is set first.
+func WithTokenSource(ts TokenSource) Option {
+	return func(o *options) {
+		o.tokens = ts
+	}
+}
+
+// newOptions applies opts over the defaults, which are taken from the environment where it sets them
+func newOptions(opts []Option) (options, error) {
+	o := options{
+		url:        envOr(_urlEnvVar, USBaseURL),
+		httpClient: &http.Client{},
+		userAgent:  envOr(_userAgentEnvVar, _defaultUserAgent),
+	}
+	if v := os.Getenv(_httpTimeoutEnvVar); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return options{}, fmt.Errorf("$%s: %v", _httpTimeoutEnvVar, err)
+		}
+		o.timeout = d
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.timeout > 0 {
+		// the given client is copied, so that its owner's other uses of it are not bounded by the timeout
+		c := *o.httpClient
+		c.Timeout = o.timeout
+		o.httpClient = &c
+	}
+	return o, nil
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,63 @@
+package pagerduty
+
+import (
+	"sort"
+
+	"github.com/echohead/stickyshift"
+)
+
+// Outcome is what a sync did with one shift
+type Outcome string
+
+const (
+	// Created means an override was created for the shift
+	Created Outcome = "created"
+	// SkippedExisting means overrides of the shift's user already covered it
+	SkippedExisting Outcome = "skipped-existing"
+	// SkippedPast means the shift had already ended
+	SkippedPast Outcome = "skipped-past"
+	// Failed means pagerduty did not create the shift's override
+	Failed Outcome = "failed"
+)
+
+type (
+	// SyncResult is what a sync did with each of the shifts it settled, in order of their start.
+	// a sync that stops early leaves out the shifts it never got to.
+	// there is no outcome for deleting: by design, a sync only creates the overrides that are missing,
+	// and leaves every override already in pagerduty alone, even one no shift calls for any more.
+	SyncResult struct {
+		Schedule string
+		Shifts   []ShiftResult
+	}
+
+	// ShiftResult is what a sync did with one shift
+	ShiftResult struct {
+		Shift   stickyshift.Shift
+		Outcome Outcome
+		// OverrideIds are the pagerduty ids of the override created for the shift, or of those that already covered it
+		OverrideIds []string
+		// Err is why the shift failed
+		Err error
+	}
+)
+
+// Count returns how many shifts had the given outcome
+func (r SyncResult) Count(o Outcome) int {
+	n := 0
+	for _, s := range r.Shifts {
+		if s.Outcome == o {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *SyncResult) add(rs ...ShiftResult) {
+	r.Shifts = append(r.Shifts, rs...)
+}
+
+func (r *SyncResult) sort() {
+	sort.SliceStable(r.Shifts, func(i, j int) bool {
+		return r.Shifts[i].Shift.Start.Before(r.Shifts[j].Shift.Start)
+	})
+}
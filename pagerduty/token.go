@@ -0,0 +1,248 @@
+package pagerduty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource supplies the Authorization header of each request to pagerduty
+type TokenSource interface {
+	Authorization(context.Context) (string, error)
+}
+
+type (
+	staticToken string
+
+	tokenFile string
+
+	// commandSource runs its command once, and keeps the token it prints for the life of the client
+	commandSource struct {
+		sync.Mutex
+		name  string
+		args  []string
+		token string
+	}
+
+	// oauthSource gets scoped tokens with the OAuth client credentials grant, getting a new one before each expires
+	oauthSource struct {
+		sync.Mutex
+		doer
+		tokenURL     string
+		clientId     string
+		clientSecret string
+		scopes       []string
+		token        string
+		expires      time.Time
+	}
+
+	oauthTokenResponse struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+)
+
+const (
+	// OAuthTokenURL is where pagerduty grants OAuth tokens
+	OAuthTokenURL = "https://identity.pagerduty.com/oauth/token"
+	// EUOAuthTokenURL is where pagerduty grants OAuth tokens in its EU service region
+	EUOAuthTokenURL = "https://identity.eu.pagerduty.com/oauth/token"
+
+	_tokenFileEnvVar         = "PD_TOKEN_FILE"
+	_tokenCommandEnvVar      = "PD_TOKEN_COMMAND"
+	_oauthClientIdEnvVar     = "PD_OAUTH_CLIENT_ID"
+	_oauthClientSecretEnvVar = "PD_OAUTH_CLIENT_SECRET"
+	_oauthScopesEnvVar       = "PD_OAUTH_SCOPES"
+	// _oauthExpiryMargin is how long before an OAuth token expires that a new one is got, or half its life if that is shorter
+	_oauthExpiryMargin = time.Minute
+)
+
+// StaticToken authenticates with a user or account API token
+func StaticToken(token string) TokenSource {
+	return staticToken(token)
+}
+
+// TokenFile authenticates with the API token in a file, which is read again for each request so that it may be rotated
+func TokenFile(path string) TokenSource {
+	return tokenFile(path)
+}
+
+// TokenCommand authenticates with the API token printed by a command, such as a secret manager's
+func TokenCommand(name string, args ...string) TokenSource {
+	return &commandSource{name: name, args: args}
+}
+
+// OAuthClientCredentials authenticates with tokens granted to an OAuth client, limited to the given scopes.
+// the scopes name the account, as in "as_account-us.example schedules.write users.read".
+// a client made with it gets the tokens with its own http client, from the identity service of its API's region.
+func OAuthClientCredentials(clientId, clientSecret string, scopes ...string) TokenSource {
+	return &oauthSource{
+		doer:         &http.Client{},
+		tokenURL:     OAuthTokenURL,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+	}
+}
+
+// tokenSourceFromEnv picks the first of $PD_TOKEN, $PD_TOKEN_FILE, $PD_TOKEN_COMMAND and the $PD_OAUTH_ variables that is set.
+// the command is run by sh, and the scopes are separated by spaces.
+func tokenSourceFromEnv() (TokenSource, error) {
+	if t := os.Getenv(_tokenEnvVar); t != "" {
+		return StaticToken(t), nil
+	}
+	if f := os.Getenv(_tokenFileEnvVar); f != "" {
+		return TokenFile(f), nil
+	}
+	if cmd := os.Getenv(_tokenCommandEnvVar); cmd != "" {
+		return TokenCommand("sh", "-c", cmd), nil
+	}
+	if id := os.Getenv(_oauthClientIdEnvVar); id != "" {
+		secret := os.Getenv(_oauthClientSecretEnvVar)
+		if secret == "" {
+			return nil, fmt.Errorf("environment variable $%s must be set with $%s", _oauthClientSecretEnvVar, _oauthClientIdEnvVar)
+		}
+		return OAuthClientCredentials(id, secret, strings.Fields(os.Getenv(_oauthScopesEnvVar))...), nil
+	}
+	return nil, fmt.Errorf("one of the environment variables $%s, $%s, $%s or $%s must be set",
+		_tokenEnvVar, _tokenFileEnvVar, _tokenCommandEnvVar, _oauthClientIdEnvVar)
+}
+
+// formatToken makes the Authorization header of a user or account API token, leaving one that already has its scheme
+func formatToken(token string) string {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, "Token ") || strings.HasPrefix(token, "Bearer ") {
+		return token
+	}
+	return "Token token=" + token
+}
+
+func (t staticToken) Authorization(context.Context) (string, error) {
+	if strings.TrimSpace(string(t)) == "" {
+		return "", fmt.Errorf("pagerduty token is empty")
+	}
+	return formatToken(string(t)), nil
+}
+
+func (f tokenFile) Authorization(context.Context) (string, error) {
+	bs, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(bs)) == "" {
+		return "", fmt.Errorf("token file %v is empty", f)
+	}
+	return formatToken(string(bs)), nil
+}
+
+func (c *commandSource) Authorization(ctx context.Context) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.token != "" {
+		return c.token, nil
+	}
+	out, err := exec.CommandContext(ctx, c.name, c.args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("token command %v failed: %v: %s", c.name, err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return "", fmt.Errorf("token command %v failed: %v", c.name, err)
+	}
+	if strings.TrimSpace(string(out)) == "" {
+		return "", fmt.Errorf("token command %v printed no token", c.name)
+	}
+	c.token = formatToken(string(out))
+	return c.token, nil
+}
+
+func (o *oauthSource) Authorization(ctx context.Context) (string, error) {
+	o.Lock()
+	defer o.Unlock()
+	now := time.Now()
+	if o.token != "" && now.Before(o.expires) {
+		return "Bearer " + o.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", o.clientId)
+	form.Set("client_secret", o.clientSecret)
+	form.Set("scope", strings.Join(o.scopes, " "))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := o.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("expected %v response for an oauth token, got %v: %v", http.StatusOK, resp.StatusCode, string(bs))
+	}
+	t := oauthTokenResponse{}
+	if err := json.Unmarshal(bs, &t); err != nil {
+		return "", err
+	}
+	if t.AccessToken == "" {
+		return "", fmt.Errorf("oauth token response has no access_token")
+	}
+	o.token = t.AccessToken
+	life := time.Duration(t.ExpiresIn) * time.Second
+	margin := _oauthExpiryMargin
+	if margin > life/2 {
+		margin = life / 2
+	}
+	o.expires = now.Add(life - margin)
+	return "Bearer " + o.token, nil
+}
+
+// forClient returns a source with the same credentials as o, that gets its tokens with d from the token URL of the API at baseURL
+func (o *oauthSource) forClient(d doer, baseURL string) TokenSource {
+	return &oauthSource{
+		doer:         d,
+		tokenURL:     tokenURLFor(baseURL),
+		clientId:     o.clientId,
+		clientSecret: o.clientSecret,
+		scopes:       o.scopes,
+	}
+}
+
+// tokenURLFor returns where tokens are granted for the API at baseURL:
+// the identity service of pagerduty's region, or the API's own address otherwise, as with a mock server.
+func tokenURLFor(baseURL string) string {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	switch baseURL {
+	case USBaseURL:
+		return OAuthTokenURL
+	case EUBaseURL:
+		return EUOAuthTokenURL
+	}
+	return baseURL + "/oauth/token"
+}
+
+// account identifies the pagerduty account of the client's tokens, which change as they expire
+func (o *oauthSource) account() string {
+	return o.clientId + "\x00" + strings.Join(o.scopes, " ")
+}
+
+// accountOf returns what identifies the account that ts authenticates with, for keying the user cache
+func accountOf(ctx context.Context, ts TokenSource) (string, error) {
+	if a, ok := ts.(interface{ account() string }); ok {
+		return a.account(), nil
+	}
+	return ts.Authorization(ctx)
+}
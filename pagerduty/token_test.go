@@ -0,0 +1,240 @@
+package pagerduty
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatToken(t *testing.T) {
+	for in, want := range map[string]string{
+		"abc":                  "Token token=abc",
+		"  abc\n":              "Token token=abc",
+		"Token token=abc":      "Token token=abc",
+		"Bearer xyz":           "Bearer xyz",
+		"Token token=abc\n":    "Token token=abc",
+		"tokenish-abc":         "Token token=tokenish-abc",
+		"Bearerless-token-xyz": "Token token=Bearerless-token-xyz",
+	} {
+		assert.Equal(t, want, formatToken(in), in)
+	}
+}
+
+func TestStaticToken(t *testing.T) {
+	auth, err := StaticToken("abc").Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Token token=abc", auth)
+
+	_, err = StaticToken(" ").Authorization(context.Background())
+	assert.Error(t, err)
+}
+
+func TestTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "token")
+
+	ts := TokenFile(f)
+	_, err = ts.Authorization(context.Background())
+	assert.Error(t, err, "a missing file should fail")
+
+	require.NoError(t, ioutil.WriteFile(f, []byte("abc\n"), 0600))
+	auth, err := ts.Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Token token=abc", auth)
+
+	require.NoError(t, ioutil.WriteFile(f, []byte("xyz"), 0600))
+	auth, err = ts.Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Token token=xyz", auth, "a rotated token should be read again")
+
+	require.NoError(t, ioutil.WriteFile(f, []byte("\n"), 0600))
+	_, err = ts.Authorization(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is empty")
+}
+
+func TestTokenCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	runs := filepath.Join(dir, "runs")
+
+	ts := TokenCommand("sh", "-c", "echo run >> "+runs+"; echo abc")
+	for i := 0; i < 2; i++ {
+		auth, err := ts.Authorization(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "Token token=abc", auth)
+	}
+	bs, err := ioutil.ReadFile(runs)
+	require.NoError(t, err)
+	assert.Equal(t, "run\n", string(bs), "the command should be run once")
+
+	_, err = TokenCommand("sh", "-c", "echo denied >&2; exit 1").Authorization(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "denied")
+
+	_, err = TokenCommand("sh", "-c", "true").Authorization(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "printed no token")
+
+	_, err = TokenCommand("💥").Authorization(context.Background())
+	assert.Error(t, err)
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	grants := 0
+	status, body := http.StatusOK, `{"access_token": "xyz", "token_type": "bearer", "expires_in": 3600}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grants++
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		assert.Equal(t, "id", r.FormValue("client_id"))
+		assert.Equal(t, "secret", r.FormValue("client_secret"))
+		assert.Equal(t, "as_account-us.example schedules.write", r.FormValue("scope"))
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	ts := OAuthClientCredentials("id", "secret", "as_account-us.example", "schedules.write").(*oauthSource)
+	ts.tokenURL = srv.URL
+	for i := 0; i < 2; i++ {
+		auth, err := ts.Authorization(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer xyz", auth)
+	}
+	assert.Equal(t, 1, grants, "a token should be kept until it expires")
+
+	ts.token = ""
+	body = `{"access_token": "abc", "expires_in": 0}`
+	for i := 0; i < 2; i++ {
+		auth, err := ts.Authorization(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer abc", auth)
+	}
+	assert.Equal(t, 3, grants, "an expired token should be replaced")
+
+	ts.token = ""
+	body = `{"access_token": "abc", "expires_in": 60}`
+	for i := 0; i < 2; i++ {
+		_, err := ts.Authorization(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, grants, "a short-lived token should still be kept for part of its life")
+
+	ts.token = ""
+	body = `{}`
+	_, err := ts.Authorization(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no access_token")
+
+	status, body = http.StatusUnauthorized, `{"error": "invalid_client"}`
+	_, err = ts.Authorization(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_client")
+
+	other := OAuthClientCredentials("id", "secret", "as_account-eu.example")
+	a, err := accountOf(context.Background(), ts)
+	require.NoError(t, err)
+	b, err := accountOf(context.Background(), other)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b, "clients scoped to other accounts should not share a user cache")
+}
+
+func TestOAuthClient(t *testing.T) {
+	paths := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"access_token": "xyz", "expires_in": 3600}`))
+	}))
+	defer srv.Close()
+
+	ts := OAuthClientCredentials("id", "secret", "as_account-us.example")
+	c, err := New(WithBaseURL(srv.URL+"/"), WithTimeout(time.Second), WithTokenSource(ts))
+	require.NoError(t, err)
+	impl := c.(*clientImpl)
+	assert.Equal(t, impl.doer, impl.tokens.(*oauthSource).doer, "tokens should be got with the client's http client")
+	auth, err := impl.tokens.Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer xyz", auth)
+	assert.Equal(t, []string{"/oauth/token"}, paths, "tokens should be got from the client's base url")
+	assert.Equal(t, OAuthTokenURL, ts.(*oauthSource).tokenURL, "the given source should not be modified")
+
+	for base, want := range map[string]string{
+		USBaseURL:       OAuthTokenURL,
+		EUBaseURL + "/": EUOAuthTokenURL,
+	} {
+		assert.Equal(t, want, tokenURLFor(base), base)
+	}
+}
+
+func TestTokenSourceFromEnv(t *testing.T) {
+	vars := []string{_tokenEnvVar, _tokenFileEnvVar, _tokenCommandEnvVar, _oauthClientIdEnvVar, _oauthClientSecretEnvVar, _oauthScopesEnvVar}
+	for _, v := range vars {
+		defer os.Setenv(v, os.Getenv(v))
+	}
+	set := func(env map[string]string) {
+		for _, v := range vars {
+			require.NoError(t, os.Setenv(v, env[v]))
+		}
+	}
+
+	set(nil)
+	_, err := tokenSourceFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), _tokenFileEnvVar)
+
+	set(map[string]string{_tokenEnvVar: "abc", _tokenFileEnvVar: "_"})
+	ts, err := tokenSourceFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, StaticToken("abc"), ts, "$PD_TOKEN should come first")
+
+	set(map[string]string{_tokenFileEnvVar: "_"})
+	ts, err = tokenSourceFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, TokenFile("_"), ts)
+
+	set(map[string]string{_tokenCommandEnvVar: "echo abc"})
+	ts, err = tokenSourceFromEnv()
+	require.NoError(t, err)
+	auth, err := ts.Authorization(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Token token=abc", auth)
+
+	set(map[string]string{_oauthClientIdEnvVar: "id"})
+	_, err = tokenSourceFromEnv()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), _oauthClientSecretEnvVar)
+
+	set(map[string]string{_oauthClientIdEnvVar: "id", _oauthClientSecretEnvVar: "secret", _oauthScopesEnvVar: " a  b "})
+	ts, err = tokenSourceFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ts.(*oauthSource).scopes)
+}
+
+func TestRequestAuthorization(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	c := &clientImpl{&http.Client{}, srv.URL, _headers, newUserCache(nil), false, StaticToken("abc")}
+	_, err := c.request(context.Background(), http.MethodGet, "/", http.StatusOK, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Token token=abc", got)
+
+	c.tokens = StaticToken("")
+	_, err = c.request(context.Background(), http.MethodGet, "/", http.StatusOK, nil)
+	assert.Error(t, err, "a request without a token should fail")
+}
@@ -0,0 +1,124 @@
+package stickyshift
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Preferences holds the preferences of each user, keyed by email
+	Preferences map[string]Preference
+
+	// Preference describes when a user would rather be on call.
+	// unlike constraints, preferences are only honored where the schedule allows it.
+	Preference struct {
+		// StartDays lists the days of the month the user would like their shifts to start on, such as "1-15" or "20"
+		StartDays []string `yaml:"startDays,omitempty"`
+		// Avoid holds times the user would rather not be on call
+		Avoid []Window `yaml:"avoid,omitempty"`
+	}
+
+	// PreferenceStat counts how many of a user's shifts honored their preferences
+	PreferenceStat struct {
+		Honored int
+		Total   int
+	}
+)
+
+// ReadPreferences loads preferences from the given yaml file
+func ReadPreferences(f string) (p Preferences, err error) {
+	bs, err := ioutil.ReadFile(f)
+	if err != nil {
+		return
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	if err = dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	if err = checkPreferences(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func checkPreferences(p Preferences) error {
+	var errs error
+	for email, pref := range p {
+		for _, r := range pref.StartDays {
+			if _, _, err := parseDayRange(r); err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("%v: %v", email, err))
+			}
+		}
+		for _, w := range pref.Avoid {
+			if !w.Start.Before(w.End) {
+				errs = multierr.Append(errs, fmt.Errorf("%v: avoided time must start before it ends, but %v >= %v", email, w.Start.Format(_timeFmt), w.End.Format(_timeFmt)))
+			}
+		}
+	}
+	return errs
+}
+
+// parseDayRange parses a day of the month such as "4", or a range of them such as "1-15"
+func parseDayRange(r string) (from, to int, err error) {
+	parts := strings.SplitN(r, "-", 2)
+	if from, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, fmt.Errorf("%q is not a day of the month or a range of them", r)
+	}
+	to = from
+	if len(parts) == 2 {
+		if to, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, fmt.Errorf("%q is not a day of the month or a range of them", r)
+		}
+	}
+	if from < 1 || to > 31 || from > to {
+		return 0, 0, fmt.Errorf("%q is not a day of the month or a range of them", r)
+	}
+	return from, to, nil
+}
+
+// against returns why shift s goes against the preferences of its user, or "" if it doesn't.
+func (p Preferences) against(s Shift) string {
+	pref, ok := p[s.Email]
+	if !ok {
+		return ""
+	}
+	for _, w := range pref.Avoid {
+		if w.Start.Before(s.End) && s.Start.Before(w.End) {
+			return fmt.Sprintf("would rather avoid %v to %v", w.Start.Format(_timeFmt), w.End.Format(_timeFmt))
+		}
+	}
+	if len(pref.StartDays) == 0 {
+		return ""
+	}
+	d := s.Start.Day()
+	for _, r := range pref.StartDays {
+		if from, to, err := parseDayRange(r); err == nil && from <= d && d <= to {
+			return ""
+		}
+	}
+	return fmt.Sprintf("prefers to start on days %v", strings.Join(pref.StartDays, ", "))
+}
+
+// Report counts, for each user with preferences, how many of their assignments honored them
+func (p Preferences) Report(as []Assignment) map[string]PreferenceStat {
+	res := map[string]PreferenceStat{}
+	for _, a := range as {
+		if _, ok := p[a.Email]; !ok {
+			continue
+		}
+		stat := res[a.Email]
+		stat.Total++
+		if p.against(a.Shift) == "" {
+			stat.Honored++
+		}
+		res[a.Email] = stat
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+package stickyshift
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPreferences(t *testing.T) {
+	_, err := ReadPreferences("💥")
+	assert.Error(t, err)
+
+	for _, test := range []struct {
+		msg     string
+		in      string
+		want    Preferences
+		wantErr string
+	}{
+		{
+			msg: "ok",
+			in: `
+a:
+  startDays: [1-15]
+  avoid:
+    - start: 2018-01-01T00:00:00Z
+      end: 2018-01-02T00:00:00Z
+`,
+			want: Preferences{"a": {
+				StartDays: []string{"1-15"},
+				Avoid:     []Window{{Start: day(1), End: day(2)}},
+			}},
+		},
+		{
+			msg:     "bad yaml",
+			in:      `a: {_: _}`,
+			wantErr: "field _ not found",
+		},
+		{
+			msg:     "bad day range",
+			in:      `a: {startDays: [15-1]}`,
+			wantErr: `a: "15-1" is not a day of the month`,
+		},
+		{
+			msg: "backwards avoid",
+			in: `
+a:
+  avoid:
+    - start: 2018-01-02T00:00:00Z
+      end: 2018-01-01T00:00:00Z
+`,
+			wantErr: "must start before it ends",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			f := tmp(t, test.in)
+			defer os.Remove(f)
+			p, err := ReadPreferences(f)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, p)
+		})
+	}
+}
+
+func TestParseDayRange(t *testing.T) {
+	from, to, err := parseDayRange("4")
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 4}, []int{from, to})
+	from, to, err = parseDayRange("1 - 15")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 15}, []int{from, to})
+	for _, r := range []string{"", "x", "1-x", "0", "32", "5-4"} {
+		_, _, err := parseDayRange(r)
+		assert.Error(t, err, r)
+	}
+}
+
+func TestPreferencesAgainst(t *testing.T) {
+	p := Preferences{
+		"a": {StartDays: []string{"1-3", "10"}},
+		"b": {Avoid: []Window{{Start: day(4), End: day(5)}}},
+	}
+	assert.Equal(t, "", p.against(Shift{Email: "x", Start: day(20), End: day(21)}), "no preferences")
+	assert.Equal(t, "", p.against(Shift{Email: "a", Start: day(3), End: day(4)}))
+	assert.Equal(t, "", p.against(Shift{Email: "a", Start: day(10), End: day(11)}))
+	assert.Equal(t, "prefers to start on days 1-3, 10", p.against(Shift{Email: "a", Start: day(4), End: day(5)}))
+	assert.Equal(t, "", p.against(Shift{Email: "b", Start: day(3), End: day(4)}))
+	assert.Contains(t, p.against(Shift{Email: "b", Start: day(3), End: day(4).Add(time.Hour)}), "would rather avoid")
+}
+
+func TestPreferencesReport(t *testing.T) {
+	p := Preferences{"a": {StartDays: []string{"1"}}}
+	assert.Equal(t, map[string]PreferenceStat{"a": {Honored: 1, Total: 2}}, p.Report([]Assignment{
+		{Shift: Shift{Email: "a", Start: day(1), End: day(2)}},
+		{Shift: Shift{Email: "b", Start: day(2), End: day(3)}},
+		{Shift: Shift{Email: "a", Start: day(3), End: day(4)}},
+	}))
+}
@@ -0,0 +1,236 @@
+package stickyshift
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Roster maps the short handles of a team's members to who they are.
+	// schedules naming a roster may use handles in place of emails.
+	Roster map[string]Member
+
+	// Member is a person on a roster
+	Member struct {
+		Email string `yaml:"email"`
+		// Zone is the IANA time zone name the member works in, such as "Europe/London"
+		Zone string `yaml:"zone,omitempty"`
+	}
+)
+
+// ReadRoster loads a roster from the given yaml file
+func ReadRoster(f string) (r Roster, err error) {
+	bs, err := ioutil.ReadFile(f)
+	if err != nil {
+		return
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	if err = dec.Decode(&r); err != nil {
+		return nil, err
+	}
+	if err = checkRosterFile(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readRoster loads the roster the schedule read from file f names, resolving its path relative to f
+func (s Schedule) readRoster(f string) (Roster, error) {
+	path := s.RosterFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(f), path)
+	}
+	r, err := ReadRoster(path)
+	if err != nil {
+		return nil, fmt.Errorf("roster %v: %v", s.RosterFile, err)
+	}
+	return r, nil
+}
+
+func checkRosterFile(r Roster) error {
+	var errs error
+	owners := map[string]string{}
+	for _, h := range r.handles() {
+		m := r[h]
+		if m.Email == "" {
+			errs = multierr.Append(errs, fmt.Errorf("%v is missing `email` field", h))
+			continue
+		}
+		if other, ok := owners[m.Email]; ok {
+			errs = multierr.Append(errs, fmt.Errorf("%v and %v both have email %v", other, h, m.Email))
+		}
+		owners[m.Email] = h
+		if _, err := time.LoadLocation(m.Zone); m.Zone != "" && err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("%v has unknown zone %q: %v", h, m.Zone, err))
+		}
+	}
+	return errs
+}
+
+// handles returns the handles of the roster, in sorted order
+func (r Roster) handles() []string {
+	res := make([]string, 0, len(r))
+	for h := range r {
+		res = append(res, h)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Email returns the email of the member with handle u, or u itself if it is not a handle on the roster
+func (r Roster) Email(u string) string {
+	if m, ok := r[u]; ok {
+		return m.Email
+	}
+	return u
+}
+
+// Handle returns the handle of the member with the given email, or the email itself if it is not on the roster
+func (r Roster) Handle(email string) string {
+	for _, h := range r.handles() {
+		if r[h].Email == email {
+			return h
+		}
+	}
+	return email
+}
+
+// mapUsers returns a copy of the schedule with every user in it replaced by f of that user
+func (s Schedule) mapUsers(f func(string) string) Schedule {
+	mapShifts := func(sl ShiftList) ShiftList {
+		res := sl.clone()
+		for i := range res {
+			res[i].Email = f(res[i].Email)
+			if res[i].SwappedFrom != "" {
+				from := strings.Split(res[i].SwappedFrom, _swappedFromSep)
+				for j := range from {
+					from[j] = f(from[j])
+				}
+				res[i].SwappedFrom = strings.Join(from, _swappedFromSep)
+			}
+		}
+		return res
+	}
+	mapAll := func(us []string) []string {
+		if us == nil {
+			return nil
+		}
+		res := make([]string, len(us))
+		for i, u := range us {
+			res[i] = f(u)
+		}
+		return res
+	}
+
+	if s.Shifts != nil {
+		s.Shifts = mapShifts(s.Shifts)
+	}
+	if s.Extend != nil {
+		ext := s.Extend.clone()
+		ext.Users = mapAll(s.Extend.Users)
+		if s.Extend.StartAfter != nil {
+			ext.StartAfter = map[string]time.Time{}
+			for u, t := range s.Extend.StartAfter {
+				ext.StartAfter[f(u)] = t
+			}
+		}
+		s.Extend = ext
+	}
+	if s.Rotation != nil {
+		r := *s.Rotation
+		r.Users = mapAll(r.Users)
+		r.Segments = append([]Segment{}, r.Segments...)
+		for i := range r.Segments {
+			r.Segments[i].Users = mapAll(r.Segments[i].Users)
+		}
+		s.Rotation = &r
+	}
+	if s.Layers != nil {
+		layers := map[string]Layer{}
+		for name, l := range s.Layers {
+			l.Shifts = mapShifts(l.Shifts)
+			layers[name] = l
+		}
+		s.Layers = layers
+	}
+	return s
+}
+
+// Users returns every user named in the schedule, in sorted order
+func (s Schedule) Users() []string {
+	res := []string{}
+	seen := map[string]bool{}
+	s.mapUsers(func(u string) string {
+		if !seen[u] {
+			seen[u] = true
+			res = append(res, u)
+		}
+		return u
+	})
+	sort.Strings(res)
+	return res
+}
+
+// UsersFrom returns the users the schedule may put on call from time now on, in sorted order: those of the shifts of
+// the schedule and its layers that have not ended by now, those it is extended with, and those of its rotation.
+// these are the users a sync checks, leaving out those who are only in its history.
+func (s Schedule) UsersFrom(now time.Time) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	add := func(us ...string) {
+		for _, u := range us {
+			if !seen[u] {
+				seen[u] = true
+				res = append(res, u)
+			}
+		}
+	}
+	sls := []ShiftList{s.Shifts}
+	for _, name := range s.LayerNames() {
+		sls = append(sls, s.Layers[name].Shifts)
+	}
+	for _, sl := range sls {
+		for _, sh := range sl {
+			if !sh.End.Before(now) {
+				add(sh.Email)
+			}
+		}
+	}
+	if s.Extend != nil {
+		add(s.Extend.Users...)
+	}
+	if s.Rotation != nil {
+		add(s.Rotation.Users...)
+		for _, seg := range s.Rotation.Segments {
+			add(seg.Users...)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func checkRoster(s Schedule) error {
+	if s.Roster == nil {
+		return nil
+	}
+	emails := map[string]bool{}
+	for _, m := range s.Roster {
+		emails[m.Email] = true
+	}
+	var errs error
+	for _, u := range s.Users() {
+		if !emails[u] {
+			errs = multierr.Append(errs, fmt.Errorf("%v is not on the roster", u))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,172 @@
+package stickyshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRoster(t *testing.T) {
+	_, err := ReadRoster("💥")
+	assert.Error(t, err)
+
+	for _, test := range []struct {
+		msg     string
+		in      string
+		want    Roster
+		wantErr string
+	}{
+		{
+			msg: "ok",
+			in: `
+al: {email: al@example.com, zone: Europe/London}
+bo: {email: bo@example.com}
+`,
+			want: Roster{
+				"al": {Email: "al@example.com", Zone: "Europe/London"},
+				"bo": {Email: "bo@example.com"},
+			},
+		},
+		{
+			msg:     "bad yaml",
+			in:      `al: {_: _}`,
+			wantErr: "field _ not found",
+		},
+		{
+			msg:     "missing email",
+			in:      `al: {zone: Europe/London}`,
+			wantErr: "al is missing `email` field",
+		},
+		{
+			msg:     "duplicate email",
+			in:      `{al: {email: x}, bo: {email: x}}`,
+			wantErr: "al and bo both have email x",
+		},
+		{
+			msg:     "bad zone",
+			in:      `al: {email: x, zone: Mars/Olympus}`,
+			wantErr: "al has unknown zone",
+		},
+	} {
+		t.Run(test.msg, func(t *testing.T) {
+			f := tmp(t, test.in)
+			defer os.Remove(f)
+			r, err := ReadRoster(f)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, r)
+		})
+	}
+}
+
+func TestReadWithRoster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "roster.yaml"), []byte(`
+al: {email: al@example.com}
+bo: {email: bo@example.com}
+`), 0644))
+
+	in := `id: foo
+roster: roster.yaml
+extend:
+  minDays: 14
+  maxDays: 28
+  users: [al, bo@example.com]
+shifts:
+  2018-01-01T00:00:00Z: al@example.com # full email
+  2018-01-02T00:00:00Z: {email: bo, swappedFrom: al}
+  2018-01-03T00:00:00Z: TBD
+`
+	f := filepath.Join(dir, "schedule.yaml")
+	require.NoError(t, ioutil.WriteFile(f, []byte(in), 0644))
+
+	s, err := Read(f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"al@example.com", "bo@example.com"}, s.Extend.Users)
+	assert.Equal(t, ShiftList{
+		{Email: "al@example.com", Start: day(1), End: day(2)},
+		{Email: "bo@example.com", Start: day(2), End: day(3), SwappedFrom: "al@example.com"},
+	}, s.Shifts)
+	assert.Equal(t, "bo@example.com", s.Roster.Email("bo"))
+	assert.Equal(t, "x", s.Roster.Email("x"))
+
+	s.Shifts = append(s.Shifts, Shift{Email: "al@example.com", Start: day(3), End: day(4)})
+	require.NoError(t, Write(f, s))
+	bs, err := ioutil.ReadFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, `id: foo
+roster: roster.yaml
+extend:
+  minDays: 14
+  maxDays: 28
+  users: [al, bo@example.com]
+shifts:
+  2018-01-01T00:00:00Z: al@example.com # full email
+  2018-01-02T00:00:00Z: {email: bo, swappedFrom: al}
+  2018-01-03T00:00:00Z: al
+  2018-01-04T00:00:00Z: TBD
+`, string(bs), "unchanged users should be left as written, and added ones written by their handles")
+
+	require.NoError(t, ioutil.WriteFile(f, []byte(`id: foo
+roster: roster.yaml
+shifts:
+  2018-01-01T00:00:00Z: al
+  2018-01-02T00:00:00Z: cy
+  2018-01-03T00:00:00Z: TBD
+`), 0644))
+	_, err = Read(f)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cy is not on the roster")
+
+	require.NoError(t, ioutil.WriteFile(f, []byte(`id: foo
+roster: missing.yaml
+shifts:
+  2018-01-01T00:00:00Z: al
+  2018-01-02T00:00:00Z: TBD
+`), 0644))
+	_, err = Read(f)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "roster missing.yaml")
+}
+
+func TestCheckRoster(t *testing.T) {
+	r := Roster{"al": {Email: "al@example.com"}}
+	expectValid(t, checkRoster,
+		Schedule{Shifts: ShiftList{{Email: "x"}}},
+		Schedule{Roster: r, Shifts: ShiftList{{Email: "al@example.com"}}},
+	)
+	expectInvalid(t, checkRoster,
+		Schedule{Roster: r, Shifts: ShiftList{{Email: "al"}}},
+		Schedule{Roster: r, Extend: &ExtendOpts{Users: []string{"x"}}},
+		Schedule{Roster: r, Rotation: &Rotation{Users: []string{"x"}}},
+		Schedule{Roster: r, Layers: map[string]Layer{"secondary": {Shifts: ShiftList{{Email: "x"}}}}},
+	)
+}
+
+func TestUsersFrom(t *testing.T) {
+	s := Schedule{
+		Shifts: ShiftList{
+			{Email: "gone", Start: day(1), End: day(2)},
+			{Email: "a", Start: day(2), End: day(3), SwappedFrom: "gone"},
+		},
+		Extend:   &ExtendOpts{Users: []string{"b"}},
+		Rotation: &Rotation{Segments: []Segment{{Users: []string{"c"}}}},
+		Layers: map[string]Layer{"secondary": {Shifts: ShiftList{
+			{Email: "left", Start: day(1), End: day(2)},
+			{Email: "d", Start: day(2), End: day(3)},
+		}}},
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, s.UsersFrom(day(2).Add(time.Hour)), "users only in the schedule's history should be left out")
+	assert.Equal(t, []string{"a", "b", "c", "d", "gone", "left"}, s.UsersFrom(day(1)))
+}
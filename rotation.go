@@ -0,0 +1,337 @@
+package stickyshift
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+type (
+	// Rotation describes a repeating sequence of equal length shifts
+	Rotation struct {
+		// Anchor is the start of a shift of the first user
+		Anchor time.Time     `yaml:"anchor"`
+		Length time.Duration `yaml:"length"`
+		Users  []string      `yaml:"users,omitempty"`
+		// Segments split each shift into parts covered by separate pools of users, in place of Users
+		Segments []Segment `yaml:"segments,omitempty"`
+	}
+
+	// Segment is a part of each day, such as business hours or the weekend, with its own pool of users.
+	// days and times are in the segment's zone, or that of the rotation's anchor if it has none.
+	// a segment without Days, From or To covers whatever the other segments don't.
+	Segment struct {
+		Name string `yaml:"name"`
+		// Zone is an IANA time zone name such as "Europe/London", for a region handing off to others around the clock
+		Zone string `yaml:"zone,omitempty"`
+		// Days the segment applies to, such as "sat". every day if empty
+		Days []string `yaml:"days,omitempty"`
+		// From and To bound the segment within each of its days, as "15:04". the whole day if empty.
+		// if To is not after From, the segment runs overnight into the next day.
+		From  string   `yaml:"from,omitempty"`
+		To    string   `yaml:"to,omitempty"`
+		Users []string `yaml:"users"`
+	}
+)
+
+const _timeOfDayFmt = "15:04"
+
+var _weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Expand returns the rotation's shifts that overlap [from, until)
+func (r Rotation) Expand(from, until time.Time) ShiftList {
+	res := ShiftList{}
+	if r.Length <= 0 || (len(r.Users) < 1 && len(r.Segments) < 1) {
+		return res
+	}
+	n := from.Sub(r.Anchor) / r.Length
+	if from.Before(r.Anchor.Add(n * r.Length)) {
+		n--
+	}
+	for start := r.Anchor.Add(n * r.Length); start.Before(until); start, n = start.Add(r.Length), n+1 {
+		end := start.Add(r.Length)
+		if len(r.Segments) < 1 {
+			res = append(res, Shift{Email: pick(r.Users, n), Start: start, End: end})
+			continue
+		}
+		for _, s := range r.segmentShifts(start, end, n) {
+			if s.End.After(from) && s.Start.Before(until) {
+				res = append(res, s)
+			}
+		}
+	}
+	return res.merge()
+}
+
+// pick returns the user whose turn the nth shift is, or "" if there are no users
+func pick(users []string, n time.Duration) string {
+	if len(users) < 1 {
+		return ""
+	}
+	i := int(n % time.Duration(len(users)))
+	if i < 0 {
+		i += len(users)
+	}
+	return users[i]
+}
+
+// segmentShifts splits the nth shift of the rotation, from start until end, into its segments.
+// parts of it not covered by any segment are left out.
+func (r Rotation) segmentShifts(start, end time.Time, n time.Duration) ShiftList {
+	bounds := []time.Time{start, end}
+	for _, seg := range r.Segments {
+		for _, w := range seg.windows(start, end, r.Anchor.Location()) {
+			for _, b := range w {
+				if b.After(start) && b.Before(end) {
+					bounds = append(bounds, b.In(start.Location()))
+				}
+			}
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i].Before(bounds[j])
+	})
+
+	res := ShiftList{}
+	for i := 0; i < len(bounds)-1; i++ {
+		if !bounds[i].Before(bounds[i+1]) {
+			continue
+		}
+		if seg, ok := r.segmentAt(bounds[i]); ok && len(seg.Users) > 0 {
+			res = append(res, Shift{Email: pick(seg.Users, n), Start: bounds[i], End: bounds[i+1]})
+		}
+	}
+	return res
+}
+
+// segmentAt returns the segment covering time t
+func (r Rotation) segmentAt(t time.Time) (Segment, bool) {
+	for _, seg := range r.Segments {
+		if len(seg.windows(t, t.Add(time.Nanosecond), r.Anchor.Location())) > 0 {
+			return seg, true
+		}
+	}
+	for _, seg := range r.Segments {
+		if seg.fallback() {
+			return seg, true
+		}
+	}
+	return Segment{}, false
+}
+
+// windows returns the times the segment covers that overlap [start, end), as pairs of start and end times.
+// def is the zone of the segment if it doesn't have its own.
+func (s Segment) windows(start, end time.Time, def *time.Location) [][2]time.Time {
+	if s.fallback() {
+		return nil
+	}
+	loc := s.location(def)
+	res := [][2]time.Time{}
+	y, m, d := start.In(loc).Date()
+	for day := time.Date(y, m, d-1, 0, 0, 0, 0, loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if ws, we, ok := s.window(day); ok && we.After(start) && ws.Before(end) {
+			res = append(res, [2]time.Time{ws, we})
+		}
+	}
+	return res
+}
+
+// window returns the time the segment covers on the given day, which starts at midnight.
+// ok is false if the segment doesn't apply to the day.
+func (s Segment) window(day time.Time) (start, end time.Time, ok bool) {
+	if !s.onDay(day.Weekday()) {
+		return
+	}
+	from, to := parseTimeOfDay(s.From), parseTimeOfDay(s.To)
+	if s.From == "" && s.To == "" {
+		to = 24 * time.Hour
+	}
+	start = at(day, from)
+	end = at(day, to)
+	if to <= from {
+		end = at(day.AddDate(0, 0, 1), to)
+	}
+	return start, end, true
+}
+
+func (s Segment) location(def *time.Location) *time.Location {
+	if s.Zone == "" {
+		return def
+	}
+	loc, err := time.LoadLocation(s.Zone)
+	if err != nil {
+		return def
+	}
+	return loc
+}
+
+func (s Segment) fallback() bool {
+	return len(s.Days) == 0 && s.From == "" && s.To == ""
+}
+
+func (s Segment) onDay(wd time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if _weekdays[strings.ToLower(d)] == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// at returns the given time of day on day, which starts at midnight.
+// it counts wall clock time, so that a segment starts at the same hour across a daylight saving time change.
+func at(day time.Time, tod time.Duration) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, int(tod/time.Hour), int(tod%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+func parseTimeOfDay(s string) time.Duration {
+	t, err := time.Parse(_timeOfDayFmt, s)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
+
+// cycle returns the time it takes the rotation to get back to the first user of each pool
+func (r Rotation) cycle() time.Duration {
+	n := len(r.Users)
+	for _, s := range r.Segments {
+		n = lcm(n, len(s.Users))
+	}
+	return r.Length * time.Duration(n)
+}
+
+func lcm(a, b int) int {
+	if a == 0 || b == 0 {
+		return a + b
+	}
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
+
+// Expand returns the schedule's shifts that overlap [from, until).
+// if the schedule has a rotation, its shifts are materialized, with the explicit shifts of the schedule taking
+// precedence over them. explicit shifts are returned whole, even if they lie outside of [from, until).
+func (s Schedule) Expand(from, until time.Time) ShiftList {
+	if s.Rotation == nil {
+		return s.Shifts
+	}
+	return s.Rotation.Expand(from, until).overlay(s.Shifts)
+}
+
+// expanded returns the shifts of the schedule over its explicit shifts and at least one full cycle of its rotation
+func (s Schedule) expanded() ShiftList {
+	if s.Rotation == nil {
+		return s.Shifts
+	}
+	from, until := s.Rotation.Anchor, s.Rotation.Anchor.Add(s.Rotation.cycle())
+	if len(s.Shifts) > 0 {
+		from = earlier(from, s.Shifts[0].Start)
+		until = later(until, s.Shifts[len(s.Shifts)-1].End)
+	}
+	return s.Expand(from, until)
+}
+
+func checkRotation(s Schedule) error {
+	r := s.Rotation
+	switch {
+	case r == nil:
+		return nil
+	case r.Anchor.IsZero():
+		return errors.New("rotation is missing `anchor` field")
+	case r.Length <= 0:
+		return fmt.Errorf("rotation.length must be positive, but found %v", r.Length)
+	case len(r.Users) > 0 && len(r.Segments) > 0:
+		return errors.New("rotation must have either `users` or `segments`, but not both")
+	case len(r.Users) < 1 && len(r.Segments) < 1:
+		return errors.New("rotation.users must not be empty")
+	}
+	return checkSegments(r.Segments)
+}
+
+func checkSegments(segs []Segment) error {
+	var errs error
+	fallbacks := 0
+	for _, s := range segs {
+		if s.fallback() {
+			fallbacks++
+		}
+		if len(s.Users) < 1 {
+			errs = multierr.Append(errs, fmt.Errorf("rotation segment %q has no users", s.Name))
+		}
+		if (s.From == "") != (s.To == "") {
+			errs = multierr.Append(errs, fmt.Errorf("rotation segment %q must set both or neither of `from` and `to`", s.Name))
+		}
+		for _, tod := range []string{s.From, s.To} {
+			if _, err := time.Parse(_timeOfDayFmt, tod); tod != "" && err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("rotation segment %q has time %q, which is not of the form %q", s.Name, tod, _timeOfDayFmt))
+			}
+		}
+		if _, err := time.LoadLocation(s.Zone); s.Zone != "" && err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("rotation segment %q has unknown zone %q: %v", s.Name, s.Zone, err))
+		}
+		for _, d := range s.Days {
+			if _, ok := _weekdays[strings.ToLower(d)]; !ok {
+				errs = multierr.Append(errs, fmt.Errorf("rotation segment %q has unknown day %q", s.Name, d))
+			}
+		}
+	}
+	if fallbacks > 1 {
+		errs = multierr.Append(errs, errors.New("at most one rotation segment may leave out `days`, `from` and `to`"))
+	}
+	return errs
+}
+
+// _gapCheckDays is how far ahead a rotation is checked for gaps in coverage, long enough to cross the daylight saving
+// time changes of every region
+const _gapCheckDays = 366
+
+func checkRotationGaps(s Schedule) error {
+	r := s.Rotation
+	if r == nil || len(r.Segments) < 1 || checkRotation(s) != nil {
+		return nil
+	}
+	for _, seg := range r.Segments {
+		if seg.fallback() {
+			return nil
+		}
+	}
+
+	until := r.Anchor.AddDate(0, 0, _gapCheckDays)
+	gaps := 0
+	var first Shift
+	prev := r.Anchor
+	for _, sh := range append(r.Expand(r.Anchor, until), Shift{Start: until}) {
+		if prev.Before(sh.Start) {
+			if gaps == 0 {
+				first = Shift{Start: prev, End: sh.Start}
+			}
+			gaps++
+		}
+		prev = later(prev, sh.End)
+	}
+	if gaps == 0 {
+		return nil
+	}
+	return fmt.Errorf("rotation segments leave %v gaps in coverage over the next %v days, the first from %v to %v",
+		gaps, _gapCheckDays, first.Start.Format(_timeFmt), first.End.Format(_timeFmt))
+}
@@ -0,0 +1,183 @@
+package stickyshift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotationExpand(t *testing.T) {
+	r := Rotation{Anchor: day(3), Length: 24 * time.Hour, Users: []string{"a", "b", "c"}}
+
+	assert.Equal(t, ShiftList{}, Rotation{}.Expand(day(1), day(2)))
+	assert.Equal(t, ShiftList{}, r.Expand(day(2), day(2)))
+	assert.Equal(t, shifts("a", "b", "c", "a"), Rotation{Anchor: day(1), Length: 24 * time.Hour, Users: r.Users}.Expand(day(1), day(5)))
+	assert.Equal(t, shifts("b", "c", "a", "b"), r.Expand(day(1), day(5)), "before the anchor")
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: day(3), End: day(4)},
+		{Email: "b", Start: day(4), End: day(5)},
+	}, r.Expand(day(3).Add(time.Hour), day(4).Add(time.Hour)), "partially overlapping shifts are whole")
+	assert.Equal(t, ShiftList{{Email: "a", Start: day(1), End: day(3)}, {Email: "b", Start: day(3), End: day(4)}},
+		Rotation{Anchor: day(1), Length: 24 * time.Hour, Users: []string{"a", "a", "b"}}.Expand(day(1), day(4)), "merged")
+}
+
+func TestRotationExpandSegments(t *testing.T) {
+	// 2018-01-01 is a monday
+	hour := func(d, h int) time.Time {
+		return day(d).Add(time.Duration(h) * time.Hour)
+	}
+
+	dayNight := Rotation{
+		Anchor: day(1),
+		Length: 48 * time.Hour,
+		Segments: []Segment{
+			{Name: "day", From: "09:00", To: "17:00", Users: []string{"a", "b"}},
+			{Name: "night", Users: []string{"c", "d"}},
+		},
+	}
+	assert.Equal(t, ShiftList{
+		{Email: "c", Start: hour(1, 0), End: hour(1, 9)},
+		{Email: "a", Start: hour(1, 9), End: hour(1, 17)},
+		{Email: "c", Start: hour(1, 17), End: hour(2, 9)},
+		{Email: "a", Start: hour(2, 9), End: hour(2, 17)},
+		{Email: "c", Start: hour(2, 17), End: hour(3, 0)},
+		{Email: "d", Start: hour(3, 0), End: hour(3, 9)},
+		{Email: "b", Start: hour(3, 9), End: hour(3, 17)},
+	}, dayNight.Expand(day(1), hour(3, 10)))
+
+	weekend := Rotation{
+		Anchor: day(1),
+		Length: 7 * 24 * time.Hour,
+		Segments: []Segment{
+			{Name: "weekend", Days: []string{"sat", "sun"}, Users: []string{"a"}},
+			{Name: "weekday", Users: []string{"b", "c"}},
+		},
+	}
+	assert.Equal(t, ShiftList{
+		{Email: "b", Start: day(1), End: day(6)},
+		{Email: "a", Start: day(6), End: day(8)},
+		{Email: "c", Start: day(8), End: day(13)},
+	}, weekend.Expand(day(1), day(9)))
+
+	overnight := Rotation{
+		Anchor: day(1),
+		Length: 24 * time.Hour,
+		Segments: []Segment{
+			{Name: "night", From: "22:00", To: "06:00", Users: []string{"a"}},
+		},
+	}
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: hour(1, 0), End: hour(1, 6)},
+		{Email: "a", Start: hour(1, 22), End: hour(2, 6)},
+	}, overnight.Expand(day(1), day(2).Add(time.Hour)), "uncovered parts are left out")
+}
+
+func TestRotationExpandDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// daylight saving time starts on 2018-03-11
+	r := Rotation{
+		Anchor: time.Date(2018, time.March, 10, 0, 0, 0, 0, ny),
+		Length: 24 * time.Hour,
+		Segments: []Segment{
+			{Name: "day", From: "09:00", To: "17:00", Users: []string{"a"}},
+		},
+	}
+	res := r.Expand(r.Anchor, r.Anchor.Add(72*time.Hour))
+	for _, s := range res {
+		assert.Equal(t, 9, s.Start.In(ny).Hour())
+		assert.Equal(t, 17, s.End.In(ny).Hour())
+	}
+}
+
+func TestScheduleExpand(t *testing.T) {
+	assert.Equal(t, shifts("a"), Schedule{Shifts: shifts("a")}.Expand(day(5), day(6)), "no rotation")
+
+	s := Schedule{
+		Rotation: &Rotation{Anchor: day(1), Length: 24 * time.Hour, Users: []string{"a", "b"}},
+		Shifts:   ShiftList{{Email: "x", Start: day(2).Add(12 * time.Hour), End: day(3).Add(12 * time.Hour)}},
+	}
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: day(1), End: day(2)},
+		{Email: "b", Start: day(2), End: day(2).Add(12 * time.Hour)},
+		{Email: "x", Start: day(2).Add(12 * time.Hour), End: day(3).Add(12 * time.Hour)},
+		{Email: "a", Start: day(3).Add(12 * time.Hour), End: day(4)},
+		{Email: "b", Start: day(4), End: day(5)},
+	}, s.Expand(day(1), day(5)))
+	assert.Equal(t, ShiftList{
+		{Email: "x", Start: day(2).Add(12 * time.Hour), End: day(3).Add(12 * time.Hour)},
+		{Email: "b", Start: day(10), End: day(11)},
+	}, s.Expand(day(10), day(11)), "explicit shifts are kept outside of the window")
+}
+
+func TestCheckRotation(t *testing.T) {
+	expectValid(t, checkRotation,
+		Schedule{},
+		Schedule{Rotation: &Rotation{Anchor: day(1), Length: time.Hour, Users: []string{"a"}}},
+	)
+	expectInvalid(t, checkRotation,
+		Schedule{Rotation: &Rotation{Length: time.Hour, Users: []string{"a"}}},
+		Schedule{Rotation: &Rotation{Anchor: day(1), Users: []string{"a"}}},
+		Schedule{Rotation: &Rotation{Anchor: day(1), Length: time.Hour}},
+		Schedule{Rotation: &Rotation{Anchor: day(1), Length: time.Hour, Users: []string{"a"}, Segments: []Segment{{Users: []string{"a"}}}}},
+	)
+}
+
+func TestCheckSegments(t *testing.T) {
+	assert.NoError(t, checkSegments([]Segment{
+		{Days: []string{"Sat", "sun"}, From: "09:00", To: "17:00", Users: []string{"a"}},
+		{Users: []string{"b"}},
+	}))
+	for _, segs := range [][]Segment{
+		{{}},
+		{{From: "09:00", Users: []string{"a"}}},
+		{{From: "9am", To: "5pm", Users: []string{"a"}}},
+		{{Days: []string{"someday"}, Users: []string{"a"}}},
+		{{Users: []string{"a"}}, {Users: []string{"b"}}},
+	} {
+		assert.Error(t, checkSegments(segs), "expected %+v to be invalid", segs)
+	}
+}
+
+func TestRotationFollowTheSun(t *testing.T) {
+	for _, z := range []string{"Asia/Singapore", "Europe/London", "America/New_York"} {
+		if _, err := time.LoadLocation(z); err != nil {
+			t.Skip("no time zone database")
+		}
+	}
+
+	// in utc over the northern winter, apac covers 00:00 to 08:00, emea 07:00 to 16:00 and amer 15:00 to 00:00 or
+	// later. over summer, london and new york move an hour earlier, so emea still meets apac and amer, but amer only
+	// reaches apac if its day ends late enough.
+	regions := func(amerTo string) []Segment {
+		return []Segment{
+			{Name: "apac", Zone: "Asia/Singapore", From: "08:00", To: "16:00", Users: []string{"a"}},
+			{Name: "emea", Zone: "Europe/London", From: "07:00", To: "16:00", Users: []string{"b"}},
+			{Name: "amer", Zone: "America/New_York", From: "10:00", To: amerTo, Users: []string{"c"}},
+		}
+	}
+	r := Rotation{
+		Anchor:   time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Length:   7 * 24 * time.Hour,
+		Segments: regions("20:00"),
+	}
+
+	assert.Equal(t, ShiftList{
+		{Email: "a", Start: r.Anchor, End: r.Anchor.Add(8 * time.Hour)},
+		{Email: "b", Start: r.Anchor.Add(8 * time.Hour), End: r.Anchor.Add(16 * time.Hour)},
+		{Email: "c", Start: r.Anchor.Add(16 * time.Hour), End: r.Anchor.Add(24 * time.Hour)},
+	}, r.Expand(r.Anchor, r.Anchor.Add(24*time.Hour)))
+	assert.NoError(t, checkRotationGaps(Schedule{Rotation: &r}))
+
+	r.Segments = regions("19:00")
+	err := checkRotationGaps(Schedule{Rotation: &r})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gaps in coverage over the next 366 days, the first from 2018-03-11T23:00:00Z to 2018-03-12T00:00:00Z")
+
+	assert.NoError(t, checkRotationGaps(Schedule{}))
+	assert.NoError(t, checkRotationGaps(Schedule{Rotation: &Rotation{Anchor: day(1), Length: time.Hour, Segments: []Segment{{Users: []string{"a"}}}}}))
+}
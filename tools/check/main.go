@@ -3,24 +3,42 @@ package main
 // given the path to a schedule config file:
 // - read it in
 // - check it for validity
+// - if -remote is set, check that each user it may still put on call is a pagerduty user who can be on call
 
 import (
+	"flag"
 	"fmt"
 	"log"
-	"os"
+	"time"
 
 	"github.com/echohead/stickyshift"
+	"github.com/echohead/stickyshift/pagerduty"
 )
 
+var _remote = flag.Bool("remote", false, "also check every user against pagerduty, which needs a token such as $PD_TOKEN or $PD_TOKEN_FILE, and honours $PD_URL, $PD_HTTP_TIMEOUT and $PD_USER_AGENT")
+
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatal("usage: check $FILE")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: check [-remote] $FILE")
 	}
-	f := os.Args[1]
+	f := flag.Arg(0)
 
-	if _, err := stickyshift.Read(f); err != nil {
+	s, err := stickyshift.Read(f)
+	if err != nil {
 		log.Fatal(f, ": ", err)
 	}
 
+	if *_remote {
+		c, err := pagerduty.New()
+		if err != nil {
+			log.Fatal(err)
+		}
+		// only the users a sync would check are checked, so that those who have left stay in the schedule's history
+		if err := c.CheckUsers(s.UsersFrom(time.Now())); err != nil {
+			log.Fatal(f, ": ", err)
+		}
+	}
+
 	fmt.Printf("%s is ok\n", f)
 }
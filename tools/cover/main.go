@@ -0,0 +1,56 @@
+package main
+
+// given the path to a schedule config file, a user and a time window:
+// - read it in
+// - hand the window to the user, splitting the shifts around it, or overriding its rotation
+// - check it for validity
+// - write it back out
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/echohead/stickyshift"
+)
+
+var (
+	_file   = flag.String("file", "", "path to the schedule config file")
+	_email  = flag.String("email", "", "email or roster handle of the user covering the window")
+	_start  = flag.String("start", "", "RFC3339 start of the window to cover")
+	_end    = flag.String("end", "", "RFC3339 end of the window to cover")
+	_note   = flag.String("note", "", "optional note on why the shift changed hands")
+	_ticket = flag.String("ticket", "", "optional ticket or link tracking the change")
+)
+
+func fatalIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	fatalIfErr(err)
+	return t
+}
+
+func main() {
+	flag.Parse()
+	if *_file == "" || *_email == "" || *_start == "" || *_end == "" {
+		log.Fatal("usage: cover -file $FILE -email $EMAIL -start $TIME -end $TIME [-note $NOTE] [-ticket $TICKET]")
+	}
+
+	s, err := stickyshift.Read(*_file)
+	fatalIfErr(err)
+
+	s, err = stickyshift.Cover(s, s.Roster.Email(*_email), parseTime(*_start), parseTime(*_end))
+	fatalIfErr(err)
+	s.Shifts, err = s.Shifts.Annotate(parseTime(*_start), *_note, *_ticket)
+	fatalIfErr(err)
+
+	fatalIfErr(stickyshift.Write(*_file, s))
+
+	fmt.Printf("%s covers %s to %s in %s\n", *_email, *_start, *_end, *_file)
+}
@@ -0,0 +1,99 @@
+package main
+
+// given the path to a schedule config file:
+// - read it in, along with any constraints and the other schedules in its directory
+// - fill it with shifts until the given time, respecting the constraints
+// - explain each assignment, and how often each user's preferences were honored
+// - write it back out
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/echohead/stickyshift"
+)
+
+var (
+	_file        = flag.String("file", "", "path to the schedule config file")
+	_until       = flag.String("until", "", "RFC3339 time to generate shifts until")
+	_length      = flag.Duration("length", 7*24*time.Hour, "length of each generated shift")
+	_constraints = flag.String("constraints", "", "optional path to a constraints file")
+	_preferences = flag.String("preferences", "", "optional path to a user preferences file")
+)
+
+func fatalIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// busy returns the shifts of the other schedules in the directory of f, which its users must not be double booked with
+func busy(f string, from, until time.Time) stickyshift.ShiftList {
+	dir := filepath.Dir(f)
+	fs, err := ioutil.ReadDir(dir)
+	fatalIfErr(err)
+	res := stickyshift.ShiftList{}
+	for _, fi := range fs {
+		path := filepath.Join(dir, fi.Name())
+		if ext := filepath.Ext(path); fi.IsDir() || (ext != ".yaml" && ext != ".yml") || path == filepath.Clean(f) {
+			continue
+		}
+		s, err := stickyshift.Read(path)
+		if err != nil {
+			continue
+		}
+		res = append(res, s.Expand(from, until)...)
+		for _, name := range s.LayerNames() {
+			res = append(res, s.Layers[name].Shifts...)
+		}
+	}
+	return res
+}
+
+func main() {
+	flag.Parse()
+	if *_file == "" || *_until == "" {
+		log.Fatal("usage: generate -file $FILE -until $TIME [-length $DURATION] [-constraints $FILE] [-preferences $FILE]")
+	}
+	until, err := time.Parse(time.RFC3339, *_until)
+	fatalIfErr(err)
+
+	s, err := stickyshift.Read(*_file)
+	fatalIfErr(err)
+
+	c := stickyshift.Constraints{}
+	if *_constraints != "" {
+		c, err = stickyshift.ReadConstraints(*_constraints)
+		fatalIfErr(err)
+	}
+	c.Busy = busy(*_file, time.Now(), until)
+	if *_preferences != "" {
+		c.Preferences, err = stickyshift.ReadPreferences(*_preferences)
+		fatalIfErr(err)
+	}
+
+	s, as, err := stickyshift.Generate(s, *_length, until, c)
+	fatalIfErr(err)
+
+	for _, a := range as {
+		fmt.Printf("%s - %s: %s\n", a.Start.Format(time.RFC3339), a.End.Format(time.RFC3339), a.Reason)
+	}
+	report := c.Preferences.Report(as)
+	emails := make([]string, 0, len(report))
+	for email := range report {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		stat := report[email]
+		fmt.Printf("%s: preferences honored for %d of %d shifts\n", email, stat.Honored, stat.Total)
+	}
+
+	fatalIfErr(stickyshift.Write(*_file, s))
+	fmt.Printf("generated %d shifts in %s\n", len(as), *_file)
+}
@@ -0,0 +1,127 @@
+package main
+
+// given a departing user and a directory of schedule config files:
+// - read each of them in
+// - hand every future shift of the user to someone else in the rotation
+// - print the plan
+// - if -apply is set, write the changed files back out
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/echohead/stickyshift"
+)
+
+var (
+	_email = flag.String("email", "", "email or roster handle of the departing user")
+	_dir   = flag.String("dir", ".", "directory holding the schedule config files")
+	_apply = flag.Bool("apply", false, "write the changes instead of only printing them")
+	_prefs = flag.String("preferences", "", "optional preferences file, weighed when choosing who takes over each shift")
+)
+
+func fatalIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// _otherFiles are the names of the config files that may sit among the schedules without being any
+var _otherFiles = map[string]bool{"roster": true, "constraints": true, "preferences": true}
+
+// schedules lists the schedule files in dir, skipping the other config files and any of skip
+func schedules(dir string, skip ...string) []string {
+	fs, err := ioutil.ReadDir(dir)
+	fatalIfErr(err)
+	res := []string{}
+outer:
+	for _, f := range fs {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml") || _otherFiles[strings.TrimSuffix(f.Name(), ext)] {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		for _, s := range skip {
+			if s != "" && filepath.Clean(s) == path {
+				continue outer
+			}
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+// removedFrom names the pools of users in s that offboarding left smaller in res
+func removedFrom(s, res stickyshift.Schedule) []string {
+	removed := []string{}
+	if s.Extend != nil && len(res.Extend.Users) < len(s.Extend.Users) {
+		removed = append(removed, "extend.users")
+	}
+	if s.Rotation != nil {
+		if len(res.Rotation.Users) < len(s.Rotation.Users) {
+			removed = append(removed, "rotation.users")
+		}
+		for i, seg := range s.Rotation.Segments {
+			if len(res.Rotation.Segments[i].Users) < len(seg.Users) {
+				removed = append(removed, fmt.Sprintf("rotation segment %q", seg.Name))
+			}
+		}
+	}
+	return removed
+}
+
+func main() {
+	flag.Parse()
+	if *_email == "" {
+		log.Fatal("usage: offboard -email $EMAIL [-dir $DIR] [-preferences $FILE] [-apply]")
+	}
+	now := time.Now()
+	var prefs stickyshift.Preferences
+	if *_prefs != "" {
+		var err error
+		prefs, err = stickyshift.ReadPreferences(*_prefs)
+		fatalIfErr(err)
+	}
+
+	for _, f := range schedules(*_dir, *_prefs) {
+		s, err := stickyshift.Read(f)
+		if err != nil {
+			log.Fatal(f, ": ", err)
+		}
+		res, rs, err := stickyshift.Offboard(s, s.Roster.Email(*_email), now, prefs)
+		if err != nil {
+			log.Fatal(f, ": ", err)
+		}
+		removed := removedFrom(s, res)
+		if len(rs) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		fmt.Printf("%s:\n", f)
+		for _, r := range rs {
+			fmt.Printf("  %s - %s: %s -> %s", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), r.Email, r.To)
+			if r.Layer != "" {
+				fmt.Printf(" in layer %s", r.Layer)
+			}
+			if a := r.Annotation(); a != "" {
+				fmt.Printf(" (%s)", a)
+			}
+			fmt.Println()
+		}
+		if len(removed) > 0 {
+			fmt.Printf("  removed %s from %s\n", *_email, strings.Join(removed, ", "))
+		}
+		if *_apply {
+			fatalIfErr(stickyshift.Write(f, res))
+		}
+	}
+
+	if !*_apply {
+		fmt.Println("dry run; pass -apply to write these changes")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+// given the path to a schedule config file and a new user:
+// - read it in
+// - add the user to the rotation, to be given shifts once their ramp-up period is over
+// - if -shadow is set, put them on call in that layer alongside the schedule until then
+// - write it back out
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/echohead/stickyshift"
+)
+
+var (
+	_file   = flag.String("file", "", "path to the schedule config file")
+	_email  = flag.String("email", "", "email or roster handle of the new user")
+	_delay  = flag.Duration("delay", 14*24*time.Hour, "how long from now the new user ramps up before being given shifts")
+	_after  = flag.String("after", "", "optional RFC3339 time from which the new user may be given shifts; overrides -delay")
+	_shadow = flag.String("shadow", "", "optional layer in which the new user shadows the schedule until they may be given shifts")
+)
+
+func fatalIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *_file == "" || *_email == "" {
+		log.Fatal("usage: onboard -file $FILE -email $EMAIL [-delay $DURATION | -after $TIME] [-shadow $LAYER]")
+	}
+
+	after := time.Now().Add(*_delay).Truncate(time.Second)
+	if *_after != "" {
+		t, err := time.Parse(time.RFC3339, *_after)
+		fatalIfErr(err)
+		after = t
+	}
+
+	s, err := stickyshift.Read(*_file)
+	fatalIfErr(err)
+
+	email := s.Roster.Email(*_email)
+	s, err = stickyshift.Onboard(s, email, after)
+	fatalIfErr(err)
+	if *_shadow != "" {
+		s, err = stickyshift.Shadow(s, *_shadow, email, time.Now().Truncate(time.Second), after)
+		fatalIfErr(err)
+	}
+
+	fatalIfErr(stickyshift.Write(*_file, s))
+
+	fmt.Printf("added %s to %s, starting after %s\n", *_email, *_file, after.Format(time.RFC3339))
+}
@@ -0,0 +1,60 @@
+package main
+
+// given the path to a schedule config file, two users and a time:
+// - read it in
+// - swap the first user's shift at that time with the second user
+// - check it for validity
+// - write it back out
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/echohead/stickyshift"
+)
+
+var (
+	_file   = flag.String("file", "", "path to the schedule config file")
+	_a      = flag.String("a", "", "email or roster handle of the user giving up a shift")
+	_b      = flag.String("b", "", "email or roster handle of the user taking the shift")
+	_at     = flag.String("at", "", "RFC3339 time within the shift to swap")
+	_until  = flag.String("until", "", "optional RFC3339 end time; if set, only the window from -at until it is handed to -b")
+	_note   = flag.String("note", "", "optional note on why the shift changed hands")
+	_ticket = flag.String("ticket", "", "optional ticket or link tracking the change")
+)
+
+func fatalIfErr(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	fatalIfErr(err)
+	return t
+}
+
+func main() {
+	flag.Parse()
+	if *_file == "" || *_a == "" || *_b == "" || *_at == "" {
+		log.Fatal("usage: swap -file $FILE -a $EMAIL -b $EMAIL -at $TIME [-until $TIME] [-note $NOTE] [-ticket $TICKET]")
+	}
+
+	s, err := stickyshift.Read(*_file)
+	fatalIfErr(err)
+
+	s, err = stickyshift.Swap(s, s.Roster.Email(*_a), s.Roster.Email(*_b), parseTime(*_at), parseTime(*_until))
+	fatalIfErr(err)
+	s.Shifts, err = s.Shifts.Annotate(parseTime(*_at), *_note, *_ticket)
+	fatalIfErr(err)
+
+	fatalIfErr(stickyshift.Write(*_file, s))
+
+	fmt.Printf("swapped %s's shift at %s with %s in %s\n", *_a, *_at, *_b, *_file)
+}
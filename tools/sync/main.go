@@ -3,18 +3,57 @@ package main
 // given the path to a schedule config file:
 // - read it in
 // - check it for validity
-// - apply it to pagerduty
+// - expand its rotation, if it has one
+// - apply it and each of its layers to pagerduty
+// - print a summary of what was done, and log each shift's outcome to -audit-log, if set
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/echohead/stickyshift"
 	"github.com/echohead/stickyshift/pagerduty"
+	"go.uber.org/multierr"
 )
 
-var ()
+// _horizonDays is how far ahead a rotation is synced, unless the schedule sets extend.maxDays
+const _horizonDays = 56
+
+var (
+	_timeout     = flag.Duration("timeout", 0, "optional bound on the whole sync")
+	_url         = flag.String("url", envOr("PD_URL", pagerduty.USBaseURL), "pagerduty API address, such as "+pagerduty.EUBaseURL+" for the EU service region ($PD_URL)")
+	_httpTimeout = flag.Duration("http-timeout", envDuration("PD_HTTP_TIMEOUT"), "optional bound on each request to pagerduty ($PD_HTTP_TIMEOUT)")
+	_userAgent   = flag.String("user-agent", envOr("PD_USER_AGENT", "stickyshift-sync"), "User-Agent header sent to pagerduty ($PD_USER_AGENT)")
+	_failFast    = flag.Bool("fail-fast", false, "stop at the first override that fails, rather than syncing every one that can be")
+	_auditLog    = flag.String("audit-log", "", "optional file to append a JSON line to for each shift synced")
+)
+
+// auditEvent is a line of the audit log, recording what a sync did with one shift
+type auditEvent struct {
+	Time        time.Time         `json:"time"`
+	File        string            `json:"file"`
+	Schedule    string            `json:"schedule"`
+	Outcome     pagerduty.Outcome `json:"outcome"`
+	Email       string            `json:"email"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	OverrideIds []string          `json:"overrideIds,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// synced is the result of syncing the schedule or one of its layers
+type synced struct {
+	name string
+	pagerduty.SyncResult
+}
 
 func fatalIfErr(err error) {
 	if err != nil {
@@ -22,20 +61,149 @@ func fatalIfErr(err error) {
 	}
 }
 
+// interrupted calls cancel on the first Ctrl-C, so that the sync stops cleanly.
+// a second Ctrl-C kills the process as usual.
+func interrupted(cancel func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		log.Print("interrupted; stopping the sync")
+		cancel()
+	}()
+}
+
+// stoppedIfErr exits if err is set, saying so if the sync was cut short by a timeout or an interrupt
+func stoppedIfErr(ctx context.Context, f string, err error) {
+	if err != nil && ctx.Err() != nil {
+		log.Fatalf("%s: sync stopped before it finished, so some overrides may already have been created: %v", f, err)
+	}
+	fatalIfErr(err)
+}
+
+// audit appends an event for each shift of r to the audit log, if there is one
+func audit(f string, r pagerduty.SyncResult) error {
+	if *_auditLog == "" || len(r.Shifts) < 1 {
+		return nil
+	}
+	w, err := os.OpenFile(*_auditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	now := time.Now().UTC()
+	for _, s := range r.Shifts {
+		e := auditEvent{
+			Time:        now,
+			File:        f,
+			Schedule:    r.Schedule,
+			Outcome:     s.Outcome,
+			Email:       s.Shift.Email,
+			Start:       s.Shift.Start,
+			End:         s.Shift.End,
+			OverrideIds: s.OverrideIds,
+		}
+		if s.Err != nil {
+			e.Error = s.Err.Error()
+		}
+		if err := enc.Encode(e); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// summarize prints a table of how many shifts had each outcome, for the schedule and each of its layers
+func summarize(results []synced) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEDULE\tID\tCREATED\tEXISTING\tPAST\tFAILED")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", r.name, r.Schedule,
+			r.Count(pagerduty.Created), r.Count(pagerduty.SkippedExisting), r.Count(pagerduty.SkippedPast), r.Count(pagerduty.Failed))
+	}
+	w.Flush()
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func envDuration(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("$%s: %v", name, err)
+	}
+	return d
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		log.Fatal("usage: PD_TOKEN='***' sync $FILE")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: PD_TOKEN='***' sync [-timeout $DURATION] [-url $URL] [-http-timeout $DURATION] [-user-agent $UA] [-fail-fast] [-audit-log $LOG] $FILE")
 	}
-	f := os.Args[1]
+	f := flag.Arg(0)
 
 	s, err := stickyshift.Read(f)
 	fatalIfErr(err)
 
-	c, err := pagerduty.New()
+	opts := []pagerduty.Option{
+		pagerduty.WithBaseURL(*_url),
+		pagerduty.WithTimeout(*_httpTimeout),
+		pagerduty.WithUserAgent(*_userAgent),
+	}
+	if *_failFast {
+		opts = append(opts, pagerduty.WithFailFast())
+	}
+	c, err := pagerduty.New(opts...)
 	fatalIfErr(err)
 
-	err = c.Sync(s.Id, s.Shifts)
-	fatalIfErr(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted(cancel)
+	if *_timeout > 0 {
+		var stop func()
+		ctx, stop = context.WithTimeout(ctx, *_timeout)
+		defer stop()
+	}
+
+	results := []synced{}
+	var errs error
+	// sync records what was done with the shifts, and stops on an error only if the sync fails fast or was cut short.
+	// otherwise, the other layers are synced and every error is reported at the end.
+	sync := func(name, sid string, shifts stickyshift.ShiftList) {
+		r, err := c.SyncContext(ctx, sid, shifts)
+		results = append(results, synced{name, r})
+		fatalIfErr(audit(f, r))
+		errs = multierr.Append(errs, err)
+		if err != nil && (*_failFast || ctx.Err() != nil) {
+			summarize(results)
+			stoppedIfErr(ctx, f, err)
+		}
+	}
 
+	now := time.Now()
+	days := _horizonDays
+	if s.Extend != nil {
+		days = s.Extend.MaxDays
+	}
+	sync("(schedule)", s.Id, s.Expand(now, now.AddDate(0, 0, days)))
+	for _, name := range s.LayerNames() {
+		l := s.Layers[name]
+		sync(name, l.Id, l.Shifts)
+	}
+
+	summarize(results)
+	if errs != nil {
+		log.Fatalf("%s: some shifts failed to sync: %v", f, errs)
+	}
 	fmt.Printf("successfully synced %s to pagerduty\n", f)
 }